@@ -0,0 +1,687 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miloszizic/habits/client"
+	"github.com/miloszizic/habits/controllers"
+	"github.com/miloszizic/habits/store"
+)
+
+const usage = `Usage:
+  habit                        list your habits
+  habit <name>                 start tracking a habit, or perform it if you already do
+  habit add [flags] <name>     start tracking a habit
+  habit do [flags] <name>      perform a habit
+  habit undo [flags] <name>    undo performing a habit in the last 10 minutes
+  habit relapse [flags] <name> log a relapse on a habit to quit
+  habit log [flags] <name>     log a check-in you forgot, for a day gone by
+  habit list [flags]           list your habits
+  habit stats [flags] <name>   show the streaks, totals and completion rates of a habit
+  habit challenge [flags] <name> take on a 30-day challenge of a habit, or list its challenges
+  habit pause [flags] <name>   pause a habit over some days without breaking its streak
+  habit resume [flags] <name>  end the pauses of a habit from today on
+  habit archive [flags] <name> archive a finished habit, or restore it with -restore
+  habit rm [flags] <name>      stop tracking a habit and delete its history
+  habit serve [flags]          serve the web interface and JSON API
+  habit migrate [flags]        migrate the database schema to the latest version
+
+Habits are kept in ./habits.db unless -store, -source or -server say otherwise.
+Run "habit <command> -h" for the flags of a command.
+`
+
+// Run runs the habit command with the arguments following the program name,
+// writing to stdout and stderr, and returns the exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	err := run(args, stdout, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "habit: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// run dispatches to the subcommand named by the first argument
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return list(args, stdout, stderr)
+	}
+	commands := map[string]func([]string, io.Writer, io.Writer) error{
+		"add":       add,
+		"do":        do,
+		"undo":      undo,
+		"relapse":   relapse,
+		"log":       logCheckIn,
+		"list":      list,
+		"stats":     stats,
+		"challenge": challenge,
+		"pause":     pause,
+		"resume":    resume,
+		"archive":   archive,
+		"rm":        remove,
+		"serve":     serve,
+		"migrate":   migrate,
+	}
+	command, ok := commands[args[0]]
+	if ok {
+		return command(args[1:], stdout, stderr)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+	return track(args, stdout, stderr)
+}
+
+// options are the flags choosing where habits are kept
+type options struct {
+	kind     string
+	source   string
+	server   string
+	token    string
+	timezone string
+	dayStart string
+	backfill int
+}
+
+// newFlagSet returns the flags of the subcommand, including the options
+// choosing the store unless it is nil
+func newFlagSet(name string, stderr io.Writer, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet("habit "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if opts == nil {
+		return flags
+	}
+	opts.databaseFlags(flags)
+	flags.StringVar(&opts.server, "server", os.Getenv("HABITS_SERVER"), "address of a habit server to use instead of a database, like http://localhost:3000 (default $HABITS_SERVER)")
+	flags.StringVar(&opts.token, "token", "", "API token of your account on the habit server (default $HABITS_TOKEN)")
+	flags.StringVar(&opts.timezone, "timezone", "UTC", "IANA timezone calendar days are counted in, like Europe/Belgrade")
+	flags.StringVar(&opts.dayStart, "day-start", "00:00", "time of day a new calendar day starts, like 04:00")
+	flags.IntVar(&opts.backfill, "backfill-days", store.DefaultBackfillDays, "how many days back check-ins can be logged or removed")
+	return flags
+}
+
+// databaseFlags adds the options choosing the database of the store
+func (o *options) databaseFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.kind, "store", "sqlite", "habit store: sqlite, mysql, postgres or memory")
+	flags.StringVar(&o.source, "source", "./habits.db", "database source name, ignored by the memory store")
+}
+
+// calendar returns the calendar the options set days to be counted in
+func (o options) calendar() (store.Calendar, error) {
+	return store.NewCalendar(o.timezone, o.dayStart)
+}
+
+// open returns the habit store the options choose: the API of a server
+// when one is set, or else a database
+func (o options) open() (store.HabitStore, error) {
+	if o.server != "" {
+		c := client.New(o.server)
+		c.Token = o.token
+		if c.Token == "" {
+			c.Token = os.Getenv("HABITS_TOKEN")
+		}
+		return c, nil
+	}
+	calendar, err := o.calendar()
+	if err != nil {
+		return nil, err
+	}
+	habits, err := store.Open(o.kind, o.source, calendar)
+	if err != nil {
+		return nil, fmt.Errorf("opening %q database: %w", o.source, err)
+	}
+	// The commands print the massages themselves
+	switch s := habits.(type) {
+	case *store.DBStore:
+		s.Output = io.Discard
+		s.BackfillDays = o.backfill
+	case *store.MemoryStore:
+		s.Output = io.Discard
+		s.BackfillDays = o.backfill
+	}
+	return habits, nil
+}
+
+// closeStore closes the connections of a store kept in a database once the
+// command is done with it
+func closeStore(habits store.HabitStore) {
+	if c, ok := habits.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// parse parses the flags of a subcommand and opens the store, returning the
+// remaining arguments joined into a habit name
+func parse(flags *flag.FlagSet, opts *options, args []string, needName bool) (store.HabitStore, string, error) {
+	err := flags.Parse(args)
+	if err != nil {
+		// The flag set already printed the problem with its usage
+		return nil, "", flag.ErrHelp
+	}
+	name := strings.Join(flags.Args(), " ")
+	if needName && name == "" {
+		flags.Usage()
+		return nil, "", flag.ErrHelp
+	}
+	habits, err := opts.open()
+	return habits, name, err
+}
+
+// add starts tracking a new habit
+func add(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("add", stderr, &opts)
+	schedule := flags.String("schedule", "daily", `how often: "daily", a weekly target like "3/week" or weekdays like "mon,wed,fri"`)
+	target := flags.Float64("target", 0, "amount to reach every day, like 20")
+	unit := flags.String("unit", "", "unit of the target, like pages")
+	description := flags.String("description", "", "what the habit is about")
+	quit := flags.Bool("quit", false, "track a habit to quit, counting the days since the last relapse")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	parsed, err := store.ParseSchedule(*schedule)
+	if err != nil {
+		return err
+	}
+	habit := store.Habit{Name: name, Description: *description, Schedule: parsed, Target: *target, Unit: *unit}
+	if *quit {
+		habit.Kind = store.QuitHabit
+	}
+	err = habits.Add(context.Background(), habit)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, store.AddedMassage(habit))
+	return nil
+}
+
+// do performs a habit
+func do(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("do", stderr, &opts)
+	amount := flags.Float64("amount", 0, "amount performed, for habits with a target")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	massage, err := habits.PerformHabit(ctx, *habit, *amount)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, massage)
+	return nil
+}
+
+// relapse logs a relapse on a habit to quit
+func relapse(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("relapse", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	massage, err := habits.Relapse(ctx, *habit)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, massage)
+	return nil
+}
+
+// logCheckIn logs a check-in of a habit for a day gone by
+func logCheckIn(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("log", stderr, &opts)
+	date := flags.String("date", "", "day the habit was performed, like 2021-10-14 (default yesterday)")
+	amount := flags.Float64("amount", 0, "amount performed, for habits with a target")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	if *date == "" {
+		calendar, err := opts.calendar()
+		if err != nil {
+			return err
+		}
+		*date = calendar.Date(time.Now(), -1)
+	}
+	day, err := time.Parse(store.DateLayout, *date)
+	if err != nil {
+		return errors.New("-date must be a date like 2021-10-14")
+	}
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.LogCheckIn(ctx, habit.ID, day, *amount)
+	if err != nil {
+		return err
+	}
+	habit, err = habits.GetHabitByID(ctx, habit.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Logged '%s' on %s, the streak is %s now.\n", name, *date, streak(*habit))
+	return nil
+}
+
+// track starts tracking the habit named by the arguments, or performs it
+// when it is already tracked, like the original command-line tool did
+func track(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if errors.Is(err, store.ErrNotFound) {
+		habit := store.Habit{Name: name}
+		err = habits.Add(ctx, habit)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(stdout, store.AddedMassage(habit))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	massage, err := habits.PerformHabit(ctx, *habit, habit.Target)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, massage)
+	return nil
+}
+
+// list prints the tracked habits
+func list(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("list", stderr, &opts)
+	archived := flags.Bool("archived", false, "list the archived habits instead")
+	habits, _, err := parse(flags, &opts, args, false)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	stored, err := habits.AllHabits(context.Background())
+	if err != nil {
+		return err
+	}
+	var all []store.Habit
+	for _, h := range stored {
+		if h.Archived() == *archived {
+			all = append(all, h)
+		}
+	}
+	if len(all) == 0 && *archived {
+		fmt.Fprintln(stdout, "You have no archived habits")
+		return nil
+	}
+	if len(all) == 0 {
+		fmt.Fprintln(stdout, "You are not tracking any habits")
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tSTREAK\tTODAY")
+	for _, h := range all {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.Name, schedule(h), streak(h), today(h))
+	}
+	return w.Flush()
+}
+
+// stats shows the figures of a habit worked out from its history
+func stats(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("stats", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	figures, err := habits.Stats(ctx, habit.ID)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\n", habit.Name, schedule(*habit))
+	fmt.Fprintf(w, "streak\t%s\n", streak(*habit))
+	fmt.Fprintf(w, "longest streak\t%d\n", figures.LongestStreak)
+	if habit.Quitting() {
+		fmt.Fprintf(w, "relapses\t%d\n", figures.CheckIns)
+	} else {
+		fmt.Fprintf(w, "check-ins\t%d\n", figures.CheckIns)
+	}
+	if habit.Quantitative() {
+		fmt.Fprintf(w, "total\t%g %s\n", figures.Total, habit.Unit)
+	}
+	fmt.Fprintf(w, "per week\t%.1f days\n", figures.PerWeek)
+	for _, c := range figures.Completion {
+		fmt.Fprintf(w, "last %d days\t%d%% (%d of %d)\n", c.Days, c.Percent(), c.Done, c.Due)
+	}
+	if habit.Challenge != nil && habit.Challenge.Running() {
+		c := habit.Challenge
+		fmt.Fprintf(w, "challenge\tday %d of %d, %d%% (%d of %d)\n", c.Day, c.Days, c.Percent(), c.Done, c.Due)
+	}
+	return w.Flush()
+}
+
+// challenge takes on a challenge of a habit, gives up on the running one or
+// lists them all
+func challenge(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("challenge", stderr, &opts)
+	days := flags.Int("days", store.DefaultChallengeDays, "how many days the challenge lasts")
+	start := flags.String("start", "", "first day of the challenge, like 2021-10-15 (default today)")
+	abandon := flags.Bool("abandon", false, "give up on the running challenge")
+	list := flags.Bool("list", false, "list the challenges of the habit, newest first")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	var first time.Time
+	if *start != "" {
+		first, err = time.Parse(store.DateLayout, *start)
+		if err != nil {
+			return errors.New("-start must be a date like 2021-10-15")
+		}
+	}
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *list:
+		challenges, err := habits.Challenges(ctx, habit.ID)
+		if err != nil {
+			return err
+		}
+		if len(challenges) == 0 {
+			fmt.Fprintf(stdout, "'%s' never took on a challenge.\n", name)
+			return nil
+		}
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "START\tDAYS\tDONE\tOUTCOME")
+		for _, c := range challenges {
+			fmt.Fprintf(w, "%s\t%d\t%d of %d\t%s\n", c.Start.Format(store.DateLayout), c.Days, c.Done, c.Due, c.Outcome)
+		}
+		return w.Flush()
+	case *abandon:
+		err = habits.AbandonChallenge(ctx, habit.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Abandoned the challenge of '%s'.\n", name)
+		return nil
+	}
+	err = habits.StartChallenge(ctx, habit.ID, first, *days)
+	if err != nil {
+		return err
+	}
+	habit, err = habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	c := habit.Challenge
+	fmt.Fprintf(stdout, "Started a %d-day challenge of '%s' from %s until %s.\n",
+		c.Days, name, c.Start.Format(store.DateLayout), c.End().Format(store.DateLayout))
+	return nil
+}
+
+// schedule describes how often the habit is due
+func schedule(h store.Habit) string {
+	if h.Quitting() {
+		return "quit"
+	}
+	if h.Quantitative() {
+		return fmt.Sprintf("%s, %g %s", h.Schedule, h.Target, h.Unit)
+	}
+	return h.Schedule.String()
+}
+
+// streak describes the current streak of the habit
+func streak(h store.Habit) string {
+	if h.Quitting() {
+		return fmt.Sprintf("%d days clean", h.Streak)
+	}
+	return fmt.Sprintf("%d %s", h.Streak, h.Schedule.Unit())
+}
+
+// today describes what is left to do about the habit today
+func today(h store.Habit) string {
+	switch {
+	case h.Quitting() || h.Archived():
+		return "-"
+	case h.PausedToday:
+		return "paused"
+	case h.Quantitative() && h.Progress > 0 && h.DueToday:
+		return fmt.Sprintf("%g of %g %s", h.Progress, h.Target, h.Unit)
+	case h.Schedule.Weekly():
+		return fmt.Sprintf("%d of %d this week", h.TimesThisWeek, h.Schedule.PerWeek)
+	case h.DueToday:
+		return "due"
+	}
+	return "done"
+}
+
+// pause pauses a habit over a range of days
+func pause(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("pause", stderr, &opts)
+	from := flags.String("from", "", "first paused day, like 2021-10-15 (default today)")
+	until := flags.String("until", "", "last paused day, like 2021-10-20 (default the first paused day)")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	if *from == "" {
+		calendar, err := opts.calendar()
+		if err != nil {
+			return err
+		}
+		*from = calendar.Date(time.Now(), 0)
+	}
+	if *until == "" {
+		*until = *from
+	}
+	first, err := time.Parse(store.DateLayout, *from)
+	if err != nil {
+		return errors.New("-from must be a date like 2021-10-15")
+	}
+	last, err := time.Parse(store.DateLayout, *until)
+	if err != nil {
+		return errors.New("-until must be a date like 2021-10-20")
+	}
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.PauseHabit(ctx, habit.ID, first, last)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Paused '%s' from %s until %s.\n", name, *from, *until)
+	return nil
+}
+
+// undo takes back the latest perform of a habit, if it is recent enough
+func undo(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("undo", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.UndoPerform(ctx, habit.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Undid performing '%s'.\n", name)
+	return nil
+}
+
+// resume ends the running and upcoming pauses of a habit
+func resume(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("resume", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.ResumeHabit(ctx, habit.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Resumed '%s'.\n", name)
+	return nil
+}
+
+// archive archives a finished habit, keeping its history, or restores it
+func archive(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("archive", stderr, &opts)
+	restore := flags.Bool("restore", false, "bring the archived habit back to your list")
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.ArchiveHabit(ctx, habit.ID, !*restore)
+	if err != nil {
+		return err
+	}
+	if *restore {
+		fmt.Fprintf(stdout, "Restored '%s'.\n", name)
+	} else {
+		fmt.Fprintf(stdout, "Archived '%s', its history is kept.\n", name)
+	}
+	return nil
+}
+
+// remove stops tracking a habit and deletes its history
+func remove(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("rm", stderr, &opts)
+	habits, name, err := parse(flags, &opts, args, true)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	ctx := context.Background()
+	habit, err := habits.GetHabit(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = habits.DeleteHabit(ctx, habit.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Deleted '%s' and its history.\n", name)
+	return nil
+}
+
+// serve serves the web interface and JSON API until interrupted
+func serve(args []string, _, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("serve", stderr, &opts)
+	addr := flags.String("addr", ":3000", "address to listen on")
+	habits, _, err := parse(flags, &opts, args, false)
+	if err != nil {
+		return err
+	}
+	defer closeStore(habits)
+	db, ok := habits.(store.Store)
+	if !ok {
+		return errors.New("serve keeps habits in a database, not on another server")
+	}
+	controllers.RunHTTP(db, *addr)
+	return nil
+}
+
+// migrate applies pending schema migrations without starting the server
+func migrate(args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := newFlagSet("migrate", stderr, nil)
+	opts.databaseFlags(flags)
+	err := flags.Parse(args)
+	if err != nil {
+		return flag.ErrHelp
+	}
+	if opts.kind == "memory" {
+		return errors.New("the memory store keeps no schema to migrate, pick -store sqlite, mysql or postgres")
+	}
+	driver, ok := map[string]string{"sqlite": "sqlite3", "mysql": "mysql", "postgres": "postgres"}[opts.kind]
+	if !ok {
+		return fmt.Errorf("unknown habit store %q", opts.kind)
+	}
+	db, err := sql.Open(driver, opts.source)
+	if err != nil {
+		return fmt.Errorf("opening %q database: %w", opts.source, err)
+	}
+	defer db.Close()
+	version, err := store.Migrate(db, driver)
+	if err != nil {
+		return fmt.Errorf("migrating %q database: %w", opts.source, err)
+	}
+	fmt.Fprintf(stdout, "database %q is at schema version %d\n", opts.source, version)
+	return nil
+}
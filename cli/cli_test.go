@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/controllers"
+	"github.com/miloszizic/habits/store"
+)
+
+// runCLI runs the command with the arguments and returns its exit code and
+// what it printed to stdout
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr)
+	if code != 0 {
+		t.Logf("habit %s: %s", strings.Join(args, " "), stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestSubcommandsWithSQLite(t *testing.T) {
+	t.Setenv("HABITS_SERVER", "")
+	source := "-source=" + filepath.Join(t.TempDir(), "habits.db")
+	code, out := runCLI(t, "add", source, "-schedule=mon,fri", "learn", "Go")
+	if code != 0 || !strings.Contains(out, "new 'learn Go' habit") {
+		t.Fatalf("add: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "add", source, "-quit", "sugar")
+	if code != 0 || !strings.Contains(out, "quitting 'sugar'") {
+		t.Fatalf("add -quit: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "add", source, "learn Go")
+	if code != 1 {
+		t.Errorf("adding a habit twice exit code = %d; want 1", code)
+	}
+	code, out = runCLI(t, "list", source)
+	if code != 0 || !strings.Contains(out, "learn Go") || !strings.Contains(out, "mon,fri") || !strings.Contains(out, "0 days clean") {
+		t.Errorf("list: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "relapse", source, "sugar")
+	if code != 0 || out == "" {
+		t.Errorf("relapse: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "log", source, "-date="+time.Now().AddDate(0, 0, -2).Format("2006-01-02"), "learn Go")
+	if code != 0 || !strings.Contains(out, "Logged 'learn Go'") {
+		t.Errorf("log: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "undo", source, "learn Go")
+	if code != 1 {
+		t.Errorf("undoing a check-in logged days ago exit code = %d; want 1", code)
+	}
+	code, _ = runCLI(t, "do", source, "learn Go")
+	if code != 0 {
+		t.Errorf("do: exit code %d", code)
+	}
+	code, out = runCLI(t, "undo", source, "learn Go")
+	if code != 0 || !strings.Contains(out, "Undid performing 'learn Go'") {
+		t.Errorf("undo: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "stats", source, "learn Go")
+	if code != 0 || !strings.Contains(out, "check-ins       1") || !strings.Contains(out, "last 7 days") {
+		t.Errorf("stats: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "challenge", source, "-days=10", "learn Go")
+	if code != 0 || !strings.Contains(out, "Started a 10-day challenge of 'learn Go' from "+time.Now().Format("2006-01-02")) {
+		t.Errorf("challenge: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "challenge", source, "learn Go")
+	if code != 1 {
+		t.Errorf("starting a second challenge exit code = %d; want 1", code)
+	}
+	code, out = runCLI(t, "stats", source, "learn Go")
+	if code != 0 || !strings.Contains(out, "challenge       day 1 of 10") {
+		t.Errorf("stats with a challenge: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "challenge", source, "-abandon", "learn Go")
+	if code != 0 || !strings.Contains(out, "Abandoned the challenge of 'learn Go'") {
+		t.Errorf("challenge -abandon: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "challenge", source, "-list", "learn Go")
+	if code != 0 || !strings.Contains(out, "abandoned") || !strings.Contains(out, "10") {
+		t.Errorf("challenge -list: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "log", source, "-backfill-days=1", "-date="+time.Now().AddDate(0, 0, -3).Format("2006-01-02"), "learn Go")
+	if code != 1 {
+		t.Errorf("logging a day out of the window exit code = %d; want 1", code)
+	}
+	code, out = runCLI(t, "pause", source, "-from=2021-10-15", "-until=2021-10-20", "learn Go")
+	if code != 0 || !strings.Contains(out, "Paused 'learn Go' from 2021-10-15 until 2021-10-20") {
+		t.Errorf("pause: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "pause", source, "-from=2021-10-20", "-until=2021-10-15", "learn Go")
+	if code != 1 {
+		t.Errorf("pausing backwards exit code = %d; want 1", code)
+	}
+	code, out = runCLI(t, "resume", source, "learn Go")
+	if code != 0 || !strings.Contains(out, "Resumed 'learn Go'") {
+		t.Errorf("resume: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "archive", source, "learn Go")
+	if code != 0 || !strings.Contains(out, "Archived 'learn Go'") {
+		t.Errorf("archive: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "list", source)
+	if code != 0 || strings.Contains(out, "learn Go") {
+		t.Errorf("list after archiving: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "list", source, "-archived")
+	if code != 0 || !strings.Contains(out, "learn Go") || strings.Contains(out, "sugar") {
+		t.Errorf("list -archived: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "archive", source, "-restore", "learn Go")
+	if code != 0 || !strings.Contains(out, "Restored 'learn Go'") {
+		t.Errorf("archive -restore: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, "rm", source, "sugar")
+	if code != 0 || !strings.Contains(out, "Deleted 'sugar'") {
+		t.Errorf("rm: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "do", source, "sugar")
+	if code != 1 {
+		t.Errorf("do on a deleted habit exit code = %d; want 1", code)
+	}
+}
+
+func TestTrackAddsThenPerforms(t *testing.T) {
+	t.Setenv("HABITS_SERVER", "")
+	source := "-source=" + filepath.Join(t.TempDir(), "habits.db")
+	code, out := runCLI(t, source, "piano")
+	if code != 0 || !strings.Contains(out, "new 'piano' habit") {
+		t.Fatalf("first run: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t, source, "piano")
+	if code != 0 || !strings.Contains(out, "piano") || strings.Contains(out, "new 'piano' habit") {
+		t.Errorf("second run: exit code %d, printed %q", code, out)
+	}
+}
+
+func TestSubcommandsWithServer(t *testing.T) {
+	habits := store.NewMemoryStore()
+	habits.Output = io.Discard
+	server := httptest.NewServer(controllers.Service(habits))
+	t.Cleanup(server.Close)
+	t.Setenv("HABITS_SERVER", server.URL)
+	ctx := context.Background()
+	user, err := habits.AddUser(ctx, "tester@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := habits.CreateToken(ctx, user.ID, "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HABITS_TOKEN", "")
+
+	code, _ := runCLI(t, "add", "read")
+	if code != 1 {
+		t.Errorf("add without a token exit code = %d; want 1", code)
+	}
+	t.Setenv("HABITS_TOKEN", token.Token)
+	code, _ = runCLI(t, "add", "-target=20", "-unit=pages", "read")
+	if code != 0 {
+		t.Fatalf("add exit code = %d; want 0", code)
+	}
+	code, out := runCLI(t, "do", "-amount=5", "read")
+	if code != 0 || out == "" {
+		t.Errorf("do: exit code %d, printed %q", code, out)
+	}
+	code, out = runCLI(t)
+	if code != 0 || !strings.Contains(out, "5 of 20 pages") {
+		t.Errorf("list: exit code %d, printed %q", code, out)
+	}
+	habit, err := habits.GetHabit(store.WithUser(ctx, user), "read")
+	if err != nil || habit.Progress != 5 {
+		t.Errorf("got habit %+v, %v on the server; want progress 5", habit, err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	source := "-source=" + filepath.Join(t.TempDir(), "habits.db")
+	code, out := runCLI(t, "migrate", "-store=sqlite", source)
+	if code != 0 || !strings.Contains(out, "is at schema version") {
+		t.Errorf("migrate: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "migrate", "-store=memory")
+	if code != 1 {
+		t.Errorf("migrate -store=memory exit code = %d; want 1", code)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	code, out := runCLI(t, "help")
+	if code != 0 || !strings.Contains(out, "habit serve") {
+		t.Errorf("help: exit code %d, printed %q", code, out)
+	}
+	code, _ = runCLI(t, "do")
+	if code != 2 {
+		t.Errorf("do without a habit exit code = %d; want 2", code)
+	}
+	code, _ = runCLI(t, "-nope")
+	if code != 2 {
+		t.Errorf("unknown flag exit code = %d; want 2", code)
+	}
+}
@@ -0,0 +1,479 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+)
+
+// Client is a HabitStore that keeps habits on a running habit server,
+// talking to its JSON API
+type Client struct {
+	// BaseURL is the address of the server, like http://localhost:3000
+	BaseURL string
+	// Token is the API token of the user whose habits to keep, or empty for
+	// habits without an owner
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New returns a Client of the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// habitJSON is a habit as the API returns it
+type habitJSON struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Kind          string    `json:"kind"`
+	Schedule      string    `json:"schedule"`
+	Target        float64   `json:"target"`
+	Unit          string    `json:"unit"`
+	LastPerformed time.Time `json:"last_performed"`
+	Streak        int       `json:"streak"`
+	LongestStreak int       `json:"longest_streak"`
+	DueToday      bool      `json:"due_today"`
+	TimesThisWeek int       `json:"times_this_week"`
+	Progress      float64   `json:"progress"`
+	PausedToday   bool      `json:"paused_today"`
+	Pauses        []struct {
+		ID    int    `json:"id"`
+		From  string `json:"from"`
+		Until string `json:"until"`
+	} `json:"pauses"`
+	ArchivedAt *time.Time     `json:"archived_at"`
+	Challenge  *challengeJSON `json:"challenge"`
+}
+
+// challengeJSON is a challenge of a habit as the API returns it
+type challengeJSON struct {
+	ID          int     `json:"id"`
+	Start       string  `json:"start"`
+	Days        int     `json:"days"`
+	AbandonedOn *string `json:"abandoned_on"`
+	Outcome     string  `json:"outcome"`
+	Day         int     `json:"day"`
+	Due         int     `json:"due"`
+	Done        int     `json:"done"`
+}
+
+// habit converts the habit returned by the API
+func (h habitJSON) habit() (store.Habit, error) {
+	schedule, err := store.ParseSchedule(h.Schedule)
+	if err != nil {
+		return store.Habit{}, err
+	}
+	habit := store.Habit{
+		ID:            h.ID,
+		Name:          h.Name,
+		Description:   h.Description,
+		Kind:          store.Kind(h.Kind),
+		LastPerformed: h.LastPerformed,
+		Streak:        h.Streak,
+		LongestStreak: h.LongestStreak,
+		Schedule:      schedule,
+		Target:        h.Target,
+		Unit:          h.Unit,
+		DueToday:      h.DueToday,
+		TimesThisWeek: h.TimesThisWeek,
+		Progress:      h.Progress,
+		PausedToday:   h.PausedToday,
+	}
+	for _, p := range h.Pauses {
+		from, err := time.Parse(store.DateLayout, p.From)
+		if err != nil {
+			return store.Habit{}, fmt.Errorf("failed to parse pause of %q with error: %w", h.Name, err)
+		}
+		until, err := time.Parse(store.DateLayout, p.Until)
+		if err != nil {
+			return store.Habit{}, fmt.Errorf("failed to parse pause of %q with error: %w", h.Name, err)
+		}
+		habit.Pauses = append(habit.Pauses, store.Pause{ID: p.ID, HabitID: h.ID, From: from, Until: until})
+	}
+	if h.ArchivedAt != nil {
+		habit.ArchivedAt = *h.ArchivedAt
+	}
+	if h.Challenge != nil {
+		challenge, err := h.Challenge.challenge(h.ID)
+		if err != nil {
+			return store.Habit{}, fmt.Errorf("failed to parse challenge of %q with error: %w", h.Name, err)
+		}
+		habit.Challenge = &challenge
+	}
+	return habit, nil
+}
+
+// challenge converts the challenge of the habit with the ID returned by the
+// API
+func (c challengeJSON) challenge(habitID int) (store.Challenge, error) {
+	start, err := time.Parse(store.DateLayout, c.Start)
+	if err != nil {
+		return store.Challenge{}, err
+	}
+	challenge := store.Challenge{
+		ID:      c.ID,
+		HabitID: habitID,
+		Start:   start,
+		Days:    c.Days,
+		Outcome: store.Outcome(c.Outcome),
+		Day:     c.Day,
+		Due:     c.Due,
+		Done:    c.Done,
+	}
+	if c.AbandonedOn != nil {
+		challenge.AbandonedOn, err = time.Parse(store.DateLayout, *c.AbandonedOn)
+		if err != nil {
+			return store.Challenge{}, err
+		}
+	}
+	return challenge, nil
+}
+
+// checkInJSON is a check-in as the API returns it
+type checkInJSON struct {
+	ID          int       `json:"id"`
+	PerformedAt time.Time `json:"performed_at"`
+	Amount      float64   `json:"amount"`
+}
+
+// performJSON is the answer of the API to performing or relapsing
+type performJSON struct {
+	Message string `json:"message"`
+}
+
+// errorJSON is the body of the error responses of the API
+type errorJSON struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Add creates the habit on the server
+func (c *Client) Add(ctx context.Context, habit store.Habit) error {
+	body := map[string]interface{}{
+		"name":        habit.Name,
+		"description": habit.Description,
+		"schedule":    habit.Schedule.String(),
+		"target":      habit.Target,
+		"unit":        habit.Unit,
+	}
+	if habit.Kind != "" {
+		body["kind"] = string(habit.Kind)
+	}
+	return c.do(ctx, http.MethodPost, "/habits", body, nil)
+}
+
+// AllHabits lists all habits on the server
+func (c *Client) AllHabits(ctx context.Context) ([]store.Habit, error) {
+	var list []habitJSON
+	err := c.do(ctx, http.MethodGet, "/habits", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	var habits []store.Habit
+	for _, h := range list {
+		habit, err := h.habit()
+		if err != nil {
+			return nil, err
+		}
+		habits = append(habits, habit)
+	}
+	return habits, nil
+}
+
+// PerformHabit performs the habit on the server and returns its massage
+func (c *Client) PerformHabit(ctx context.Context, habit store.Habit, amount float64) (string, error) {
+	var body interface{}
+	if amount != 0 {
+		body = map[string]float64{"amount": amount}
+	}
+	var performed performJSON
+	err := c.do(ctx, http.MethodPost, habitPath(habit.ID)+"/perform", body, &performed)
+	return performed.Message, err
+}
+
+// Relapse logs a slip on the habit to quit and returns its massage
+func (c *Client) Relapse(ctx context.Context, habit store.Habit) (string, error) {
+	var performed performJSON
+	err := c.do(ctx, http.MethodPost, habitPath(habit.ID)+"/relapse", nil, &performed)
+	return performed.Message, err
+}
+
+// GetHabit returns the habit with the name from the server
+func (c *Client) GetHabit(ctx context.Context, name string) (*store.Habit, error) {
+	var list []habitJSON
+	err := c.do(ctx, http.MethodGet, "/habits?name="+url.QueryEscape(name), nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("failed to find Habit %q: %w", name, store.ErrNotFound)
+	}
+	habit, err := list[0].habit()
+	if err != nil {
+		return nil, err
+	}
+	return &habit, nil
+}
+
+// GetHabitByID returns the habit with the ID from the server
+func (c *Client) GetHabitByID(ctx context.Context, id int) (*store.Habit, error) {
+	var h habitJSON
+	err := c.do(ctx, http.MethodGet, habitPath(id), nil, &h)
+	if err != nil {
+		return nil, err
+	}
+	habit, err := h.habit()
+	if err != nil {
+		return nil, err
+	}
+	return &habit, nil
+}
+
+// UpdateHabit changes the name, description, schedule, target and unit of
+// the habit with the ID of the given one on the server
+func (c *Client) UpdateHabit(ctx context.Context, habit store.Habit) error {
+	body := map[string]interface{}{
+		"name":        habit.Name,
+		"description": habit.Description,
+		"schedule":    habit.Schedule.String(),
+		"target":      habit.Target,
+		"unit":        habit.Unit,
+	}
+	return c.do(ctx, http.MethodPatch, habitPath(habit.ID), body, nil)
+}
+
+// DeleteHabit deletes the habit with the ID and its history on the server
+func (c *Client) DeleteHabit(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, habitPath(id), nil, nil)
+}
+
+// PauseHabit pauses the habit with the ID from one date until another on
+// the server
+func (c *Client) PauseHabit(ctx context.Context, id int, from, until time.Time) error {
+	body := map[string]string{
+		"from":  from.Format(store.DateLayout),
+		"until": until.Format(store.DateLayout),
+	}
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/pauses", body, nil)
+}
+
+// ResumeHabit ends the running and upcoming pauses of the habit with the ID
+// on the server
+func (c *Client) ResumeHabit(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/resume", nil, nil)
+}
+
+// ArchiveHabit archives the habit with the ID on the server, or restores it
+func (c *Client) ArchiveHabit(ctx context.Context, id int, archived bool) error {
+	return c.do(ctx, http.MethodPatch, habitPath(id), map[string]bool{"archived": archived}, nil)
+}
+
+// LogCheckIn records a check-in of the amount for the habit with the ID on
+// the day of the date on the server
+func (c *Client) LogCheckIn(ctx context.Context, id int, date time.Time, amount float64) error {
+	body := map[string]interface{}{"date": date.Format(store.DateLayout)}
+	if amount != 0 {
+		body["amount"] = amount
+	}
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/history", body, nil)
+}
+
+// DeleteCheckIn removes the check-in with the given ID from the history of
+// the habit with the ID on the server
+func (c *Client) DeleteCheckIn(ctx context.Context, id, checkInID int) error {
+	return c.do(ctx, http.MethodDelete, habitPath(id)+"/history/"+strconv.Itoa(checkInID), nil, nil)
+}
+
+// UndoPerform takes back the latest check-in of the habit with the ID, if it
+// is recent enough
+func (c *Client) UndoPerform(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/undo", nil, nil)
+}
+
+// Stats returns the figures of the habit with the ID worked out by the
+// server. The API leaves out the activity of every day, so Year is empty.
+func (c *Client) Stats(ctx context.Context, id int) (*store.Stats, error) {
+	var j struct {
+		Streak        int     `json:"streak"`
+		LongestStreak int     `json:"longest_streak"`
+		CheckIns      int     `json:"check_ins"`
+		Total         float64 `json:"total"`
+		PerWeek       float64 `json:"per_week"`
+		Completion    []struct {
+			Days int `json:"days"`
+			Due  int `json:"due"`
+			Done int `json:"done"`
+		} `json:"completion"`
+	}
+	err := c.do(ctx, http.MethodGet, habitPath(id)+"/stats", nil, &j)
+	if err != nil {
+		return nil, err
+	}
+	stats := &store.Stats{
+		Streak:        j.Streak,
+		LongestStreak: j.LongestStreak,
+		CheckIns:      j.CheckIns,
+		Total:         j.Total,
+		PerWeek:       j.PerWeek,
+	}
+	for _, completion := range j.Completion {
+		stats.Completion = append(stats.Completion, store.Completion(completion))
+	}
+	return stats, nil
+}
+
+// StartChallenge takes on a challenge of the habit with the ID over days from
+// the date of start on the server, where a zero start and days leave the
+// defaults of the server
+func (c *Client) StartChallenge(ctx context.Context, id int, start time.Time, days int) error {
+	body := map[string]interface{}{}
+	if !start.IsZero() {
+		body["start"] = start.Format(store.DateLayout)
+	}
+	if days != 0 {
+		body["days"] = days
+	}
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/challenges", body, nil)
+}
+
+// AbandonChallenge gives up on the running challenge of the habit with the ID
+// on the server
+func (c *Client) AbandonChallenge(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, habitPath(id)+"/challenges/abandon", nil, nil)
+}
+
+// Challenges returns every challenge of the habit with the ID, newest first
+func (c *Client) Challenges(ctx context.Context, id int) ([]store.Challenge, error) {
+	var list []challengeJSON
+	err := c.do(ctx, http.MethodGet, habitPath(id)+"/challenges", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	var challenges []store.Challenge
+	for _, j := range list {
+		challenge, err := j.challenge(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse challenge with error: %w", err)
+		}
+		challenges = append(challenges, challenge)
+	}
+	return challenges, nil
+}
+
+// History returns every check-in of the habit, oldest first
+func (c *Client) History(ctx context.Context, habit store.Habit) ([]store.CheckIn, error) {
+	var list []checkInJSON
+	err := c.do(ctx, http.MethodGet, habitPath(habit.ID)+"/history", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	var history []store.CheckIn
+	for _, c := range list {
+		history = append(history, store.CheckIn{
+			ID:          c.ID,
+			HabitID:     habit.ID,
+			PerformedAt: c.PerformedAt,
+			Amount:      c.Amount,
+		})
+	}
+	return history, nil
+}
+
+// habitPath returns the API path of the habit with the ID
+func habitPath(id int) string {
+	return "/habits/" + strconv.Itoa(id)
+}
+
+// do sends a request with the JSON body, if any, to the API path and decodes
+// the JSON answer into out, if any. Error responses are mapped back to the
+// errors of the store.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach habit server with error: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return responseError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.NewDecoder(res.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("failed to decode answer of habit server with error: %w", err)
+	}
+	return nil
+}
+
+// responseError maps an error response of the API to the matching store error
+func responseError(res *http.Response) error {
+	var body errorJSON
+	err := json.NewDecoder(res.Body).Decode(&body)
+	if err != nil || body.Error.Message == "" {
+		return fmt.Errorf("habit server answered %s", res.Status)
+	}
+	var sentinel error
+	switch body.Error.Code {
+	case "not_found":
+		sentinel = store.ErrNotFound
+	case "exists":
+		sentinel = store.ErrExists
+	case "invalid":
+		sentinel = store.ErrInvalid
+	default:
+		return errors.New(body.Error.Message)
+	}
+	return apiError{message: body.Error.Message, err: sentinel}
+}
+
+// apiError is an error answered by the API, which matches the store error
+// of its code with errors.Is
+type apiError struct {
+	message string
+	err     error
+}
+
+func (e apiError) Error() string {
+	return e.message
+}
+
+func (e apiError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,376 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/client"
+	"github.com/miloszizic/habits/controllers"
+	"github.com/miloszizic/habits/store"
+)
+
+// newClient returns a client of a test server keeping habits in memory
+func newClient(t *testing.T) (*client.Client, *store.FixedClock) {
+	t.Helper()
+	habits := store.NewMemoryStore()
+	habits.Output = io.Discard
+	clock := store.NewFixedClock(time.Date(2021, 10, 15, 17, 8, 0, 0, time.UTC))
+	habits.Clock = clock
+	server := httptest.NewServer(controllers.Service(habits))
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	user, err := habits.AddUser(ctx, "tester@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := habits.CreateToken(ctx, user.ID, "tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(server.URL + "/")
+	c.Token = token.Token
+	return c, clock
+}
+
+func TestClientKeepsHabitsOnTheServer(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "learn Go", Schedule: store.Schedule{PerWeek: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "learn Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.ID == 0 || habit.Kind != store.BuildHabit || habit.Schedule.String() != "3/week" {
+		t.Errorf("got habit %+v", habit)
+	}
+	clock.AddDate(0, 0, 1)
+	massage, err := c.PerformHabit(ctx, *habit, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(massage, "1 of 3 times this week") {
+		t.Errorf("got massage %q", massage)
+	}
+	history, err := c.History(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || !history[0].PerformedAt.Equal(clock.Now()) || history[0].HabitID != habit.ID {
+		t.Errorf("got history %+v; want the one check-in", history)
+	}
+	habit.Name = "golang"
+	habit.Description = "an hour a day"
+	err = c.UpdateHabit(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := c.AllHabits(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "golang" || all[0].ID != habit.ID {
+		t.Errorf("got habits %+v; want the renamed one", all)
+	}
+	renamed, err := c.GetHabitByID(ctx, habit.ID)
+	if err != nil || renamed.Name != "golang" || renamed.Description != "an hour a day" {
+		t.Errorf("got habit %+v, %v by ID; want the renamed one", renamed, err)
+	}
+	err = c.DeleteHabit(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err = c.AllHabits(ctx)
+	if err != nil || len(all) != 0 {
+		t.Errorf("got habits %+v, %v; want none", all, err)
+	}
+}
+
+func TestClientPausesAndArchives(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.PauseHabit(ctx, habit.ID, clock.Now(), clock.Now().AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err = c.GetHabitByID(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !habit.PausedToday || len(habit.Pauses) != 1 || habit.Pauses[0].Until.Format("2006-01-02") != "2021-10-17" {
+		t.Errorf("got habit %+v; want it paused until 2021-10-17", habit)
+	}
+	err = c.ResumeHabit(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ArchiveHabit(ctx, habit.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err = c.GetHabitByID(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.PausedToday || !habit.Archived() {
+		t.Errorf("got habit %+v; want it resumed and archived", habit)
+	}
+	err = c.PauseHabit(ctx, habit.ID, clock.Now(), clock.Now().AddDate(0, 0, -1))
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("got error %v pausing backwards; want ErrInvalid", err)
+	}
+}
+
+func TestClientBackfills(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "read", Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 1)
+	err = c.LogCheckIn(ctx, habit.ID, clock.Now().AddDate(0, 0, -1), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err = c.GetHabitByID(ctx, habit.ID)
+	if err != nil || habit.Streak != 1 || habit.LongestStreak != 1 {
+		t.Fatalf("got habit %+v, %v; want yesterday's streak", habit, err)
+	}
+	history, err := c.History(ctx, *habit)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("got history %+v, %v; want the logged check-in", history, err)
+	}
+	err = c.DeleteCheckIn(ctx, habit.ID, history[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.DeleteCheckIn(ctx, habit.ID, history[0].ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got error %v removing a check-in twice; want ErrNotFound", err)
+	}
+	err = c.LogCheckIn(ctx, habit.ID, clock.Now().AddDate(0, 0, 1), 20)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("got error %v logging tomorrow; want ErrInvalid", err)
+	}
+}
+
+func TestClientUndoesPerforms(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 1)
+	if _, err := c.PerformHabit(ctx, *habit, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = c.UndoPerform(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	undone, err := c.GetHabitByID(ctx, habit.ID)
+	if err != nil || undone.Streak != 0 || !undone.LastPerformed.Equal(habit.LastPerformed) {
+		t.Fatalf("got habit %+v, %v; want it as before the perform", undone, err)
+	}
+	err = c.UndoPerform(ctx, habit.ID)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("got error %v undoing twice; want ErrInvalid", err)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "read", Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 1)
+	for _, amount := range []float64{5, 15} {
+		if _, err := c.PerformHabit(ctx, *habit, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := c.Stats(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CheckIns != 2 || stats.Total != 20 || len(stats.Completion) != 4 || stats.Completion[0].Percent() != 100 {
+		t.Errorf("got stats %+v; want today's target met", stats)
+	}
+	_, err = c.Stats(ctx, 404)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got error %v for the stats of a missing habit; want ErrNotFound", err)
+	}
+}
+
+func TestClientChallenges(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err := c.GetHabit(ctx, "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 1)
+	err = c.StartChallenge(ctx, habit.ID, time.Time{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit, err = c.GetHabit(ctx, "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch := habit.Challenge; ch == nil || ch.Days != 3 || !ch.Running() || ch.Day != 1 || ch.Start.Format("2006-01-02") != "2021-10-16" {
+		t.Fatalf("got challenge %+v; want a running 3-day challenge from 2021-10-16", habit.Challenge)
+	}
+	err = c.StartChallenge(ctx, habit.ID, time.Time{}, 0)
+	if !errors.Is(err, store.ErrExists) {
+		t.Errorf("got error %v starting a second challenge; want ErrExists", err)
+	}
+	err = c.AbandonChallenge(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenges, err := c.Challenges(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(challenges) != 1 || !challenges[0].Abandoned() || challenges[0].Outcome != store.ChallengeAbandoned {
+		t.Errorf("got challenges %+v; want the abandoned one", challenges)
+	}
+	err = c.AbandonChallenge(ctx, habit.ID)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("got error %v abandoning without a challenge running; want ErrInvalid", err)
+	}
+	_, err = c.Challenges(ctx, 404)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got error %v for the challenges of a missing habit; want ErrNotFound", err)
+	}
+}
+
+func TestClientRelapse(t *testing.T) {
+	c, clock := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 3)
+	habit, err := c.GetHabit(ctx, "sugar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	massage, err := c.Relapse(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(massage, "after 3 days") {
+		t.Errorf("got massage %q", massage)
+	}
+}
+
+func TestClientMapsErrorsToStoreErrors(t *testing.T) {
+	c, _ := newClient(t)
+	ctx := context.Background()
+	err := c.Add(ctx, store.Habit{Name: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := map[string]struct {
+		err  error
+		want error
+	}{
+		"missing": {c.DeleteHabit(ctx, 99), store.ErrNotFound},
+		"no name": {getHabit(ctx, c, "piano"), store.ErrNotFound},
+		"exists":  {c.Add(ctx, store.Habit{Name: "Go"}), store.ErrExists},
+		"invalid": {c.Add(ctx, store.Habit{}), store.ErrInvalid},
+		"update":  {c.UpdateHabit(ctx, store.Habit{ID: 99, Name: "piano"}), store.ErrNotFound},
+	}
+	for name, tc := range tcs {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: got error %v; want %v", name, tc.err, tc.want)
+		}
+	}
+}
+
+// getHabit returns the error of getting the habit with the name
+func getHabit(ctx context.Context, c *client.Client, name string) error {
+	_, err := c.GetHabit(ctx, name)
+	return err
+}
+
+func TestClientCannotReachServer(t *testing.T) {
+	server := httptest.NewServer(nil)
+	server.Close()
+	_, err := client.New(server.URL).AllHabits(context.Background())
+	if err == nil {
+		t.Error("got no error from a closed server")
+	}
+}
+
+func TestClientActsForTheUserOfItsToken(t *testing.T) {
+	habits := store.NewMemoryStore()
+	habits.Output = io.Discard
+	server := httptest.NewServer(controllers.Service(habits))
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+	ana, err := habits.AddUser(ctx, "ana@example.com", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := habits.CreateToken(ctx, ana.ID, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(server.URL)
+	c.Token = token.Token
+	if err := c.Add(ctx, store.Habit{Name: "piano"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := habits.GetHabit(store.WithUser(ctx, ana), "piano"); err != nil {
+		t.Errorf("habit added with Ana's token is not hers: %v", err)
+	}
+	if err := habits.RevokeToken(ctx, ana.ID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AllHabits(ctx); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("listing habits with a revoked token: got %v; want an error", err)
+	}
+	c.Token = ""
+	if _, err := c.AllHabits(ctx); err == nil {
+		t.Error("listing habits without a token: got no error")
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+	_ "time/tzdata"
+
+	"github.com/miloszizic/habits/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -1,7 +0,0 @@
-package main
-
-import "github.com/miloszizic/habits/controllers"
-
-func main() {
-	controllers.RunHTTP()
-}
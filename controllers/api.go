@@ -0,0 +1,776 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/miloszizic/habits/openapi"
+	"github.com/miloszizic/habits/store"
+)
+
+// maxBodySize limits the size of JSON request bodies
+const maxBodySize = 1 << 20
+
+// API serves habits as JSON for scripts and mobile clients. Requests with
+// the session cookie of a signed-in user or one of the user's API tokens act
+// on that user's habits, and the others on habits without an owner.
+type API struct {
+	Store     store.HabitStore
+	Sessions  store.SessionStore
+	APITokens store.TokenStore
+}
+
+// Routes returns the router of the API, mounted under /api/v1
+func (a API) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/openapi.yaml", a.Spec)
+	r.Group(func(r chi.Router) {
+		r.Use(a.Authenticate)
+		r.Get("/habits", a.List)
+		r.Post("/habits", a.Create)
+		r.Get("/habits/{id}", a.Get)
+		r.Patch("/habits/{id}", a.Update)
+		r.Delete("/habits/{id}", a.Delete)
+		r.Post("/habits/{id}/perform", a.Perform)
+		r.Post("/habits/{id}/relapse", a.Relapse)
+		r.Post("/habits/{id}/undo", a.Undo)
+		r.Post("/habits/{id}/pauses", a.Pause)
+		r.Post("/habits/{id}/resume", a.Resume)
+		r.Get("/habits/{id}/history", a.History)
+		r.Get("/habits/{id}/stats", a.Stats)
+		r.Get("/habits/{id}/challenges", a.Challenges)
+		r.Post("/habits/{id}/challenges", a.StartChallenge)
+		r.Post("/habits/{id}/challenges/abandon", a.AbandonChallenge)
+		r.Post("/habits/{id}/history", a.LogCheckIn)
+		r.Delete("/habits/{id}/history/{checkInID}", a.DeleteCheckIn)
+	})
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", fmt.Sprintf("method %s is not allowed here", r.Method))
+	})
+	return r
+}
+
+// habitJSON is a habit as the API returns it
+type habitJSON struct {
+	ID            int            `json:"id"`
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Kind          string         `json:"kind"`
+	Schedule      string         `json:"schedule"`
+	Target        float64        `json:"target"`
+	Unit          string         `json:"unit"`
+	LastPerformed time.Time      `json:"last_performed"`
+	Streak        int            `json:"streak"`
+	LongestStreak int            `json:"longest_streak"`
+	DueToday      bool           `json:"due_today"`
+	TimesThisWeek int            `json:"times_this_week"`
+	Progress      float64        `json:"progress"`
+	PausedToday   bool           `json:"paused_today"`
+	Pauses        []pauseJSON    `json:"pauses"`
+	ArchivedAt    *time.Time     `json:"archived_at"`
+	Challenge     *challengeJSON `json:"challenge"`
+}
+
+// pauseJSON is a pause of a habit as the API returns it, with dates like
+// 2021-10-15
+type pauseJSON struct {
+	ID    int    `json:"id"`
+	From  string `json:"from"`
+	Until string `json:"until"`
+}
+
+// challengeJSON is a challenge of a habit as the API returns it, with dates
+// like 2021-10-15
+type challengeJSON struct {
+	ID          int     `json:"id"`
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Days        int     `json:"days"`
+	AbandonedOn *string `json:"abandoned_on"`
+	Outcome     string  `json:"outcome"`
+	Day         int     `json:"day"`
+	Due         int     `json:"due"`
+	Done        int     `json:"done"`
+	Rate        float64 `json:"rate"`
+}
+
+// newChallengeJSON converts the challenge for the API
+func newChallengeJSON(c store.Challenge) challengeJSON {
+	j := challengeJSON{
+		ID:      c.ID,
+		Start:   c.Start.Format(store.DateLayout),
+		End:     c.End().Format(store.DateLayout),
+		Days:    c.Days,
+		Outcome: string(c.Outcome),
+		Day:     c.Day,
+		Due:     c.Due,
+		Done:    c.Done,
+		Rate:    store.Completion{Due: c.Due, Done: c.Done}.Rate(),
+	}
+	if c.Abandoned() {
+		abandonedOn := c.AbandonedOn.Format(store.DateLayout)
+		j.AbandonedOn = &abandonedOn
+	}
+	return j
+}
+
+// newHabitJSON converts the habit for the API
+func newHabitJSON(h store.Habit) habitJSON {
+	j := habitJSON{
+		ID:            h.ID,
+		Name:          h.Name,
+		Description:   h.Description,
+		Kind:          string(h.Kind),
+		Schedule:      h.Schedule.String(),
+		Target:        h.Target,
+		Unit:          h.Unit,
+		LastPerformed: h.LastPerformed,
+		Streak:        h.Streak,
+		LongestStreak: h.LongestStreak,
+		DueToday:      h.DueToday,
+		TimesThisWeek: h.TimesThisWeek,
+		Progress:      h.Progress,
+		PausedToday:   h.PausedToday,
+		Pauses:        make([]pauseJSON, 0, len(h.Pauses)),
+	}
+	for _, p := range h.Pauses {
+		j.Pauses = append(j.Pauses, pauseJSON{ID: p.ID, From: p.From.Format(store.DateLayout), Until: p.Until.Format(store.DateLayout)})
+	}
+	if h.Archived() {
+		j.ArchivedAt = &h.ArchivedAt
+	}
+	if h.Challenge != nil {
+		challenge := newChallengeJSON(*h.Challenge)
+		j.Challenge = &challenge
+	}
+	return j
+}
+
+// checkInJSON is a check-in as the API returns it
+type checkInJSON struct {
+	ID          int       `json:"id"`
+	PerformedAt time.Time `json:"performed_at"`
+	Amount      float64   `json:"amount"`
+}
+
+// statsJSON are the figures of a habit as the API returns them
+type statsJSON struct {
+	Streak        int              `json:"streak"`
+	LongestStreak int              `json:"longest_streak"`
+	CheckIns      int              `json:"check_ins"`
+	Total         float64          `json:"total"`
+	PerWeek       float64          `json:"per_week"`
+	Completion    []completionJSON `json:"completion"`
+}
+
+// completionJSON is the completion rate of a habit over the last days
+type completionJSON struct {
+	Days int     `json:"days"`
+	Due  int     `json:"due"`
+	Done int     `json:"done"`
+	Rate float64 `json:"rate"`
+}
+
+// createRequest is the body of a request to create a habit
+type createRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Kind        string  `json:"kind"`
+	Schedule    string  `json:"schedule"`
+	Target      float64 `json:"target"`
+	Unit        string  `json:"unit"`
+}
+
+// updateRequest is the body of a request to update a habit, where only the
+// fields that are set change
+type updateRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Schedule    *string  `json:"schedule"`
+	Target      *float64 `json:"target"`
+	Unit        *string  `json:"unit"`
+	Archived    *bool    `json:"archived"`
+}
+
+// pauseRequest is the body of a request to pause a habit
+type pauseRequest struct {
+	From  string `json:"from"`
+	Until string `json:"until"`
+}
+
+// checkInRequest is the body of a request to log a check-in for a past day
+type checkInRequest struct {
+	Date   string  `json:"date"`
+	Amount float64 `json:"amount"`
+}
+
+// challengeRequest is the optional body of a request to start a challenge,
+// which runs from today for DefaultChallengeDays days unless told otherwise
+type challengeRequest struct {
+	Start string `json:"start"`
+	Days  int    `json:"days"`
+}
+
+// performRequest is the optional body of a request to perform a habit
+type performRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+// performResponse tells how performing or relapsing went
+type performResponse struct {
+	Message string    `json:"message"`
+	Habit   habitJSON `json:"habit"`
+}
+
+// errorJSON is the body of every error response
+type errorJSON struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// List handler returns all habits, or only the one with the name of the
+// name query parameter when it is set
+func (a API) List(w http.ResponseWriter, r *http.Request) {
+	habits, err := a.Store.AllHabits(r.Context())
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	_, filtered := r.URL.Query()["name"]
+	name := r.URL.Query().Get("name")
+	list := make([]habitJSON, 0, len(habits))
+	for _, h := range habits {
+		if filtered && h.Name != name {
+			continue
+		}
+		list = append(list, newHabitJSON(h))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Get handler returns the habit with the ID in the path
+func (a API) Get(w http.ResponseWriter, r *http.Request) {
+	habit, err := a.habit(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newHabitJSON(*habit))
+}
+
+// Create handler adds a habit and returns it with its location
+func (a API) Create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	schedule, err := store.ParseSchedule(req.Schedule)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.Add(r.Context(), store.Habit{
+		Name:        req.Name,
+		Description: req.Description,
+		Kind:        store.Kind(req.Kind),
+		Schedule:    schedule,
+		Target:      req.Target,
+		Unit:        req.Unit,
+	})
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	habit, err := a.Store.GetHabit(r.Context(), req.Name)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/habits/"+strconv.Itoa(habit.ID))
+	writeJSON(w, http.StatusCreated, newHabitJSON(*habit))
+}
+
+// Update handler changes the fields of the habit set in the request
+func (a API) Update(w http.ResponseWriter, r *http.Request) {
+	var req updateRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	habit, err := a.habit(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	if req.Name != nil {
+		habit.Name = *req.Name
+	}
+	if req.Description != nil {
+		habit.Description = *req.Description
+	}
+	if req.Schedule != nil {
+		habit.Schedule, err = store.ParseSchedule(*req.Schedule)
+		if err != nil {
+			apiStoreError(w, err)
+			return
+		}
+	}
+	if req.Target != nil {
+		habit.Target = *req.Target
+	}
+	if req.Unit != nil {
+		habit.Unit = *req.Unit
+	}
+	err = a.Store.UpdateHabit(r.Context(), *habit)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	if req.Archived != nil {
+		err = a.Store.ArchiveHabit(r.Context(), habit.ID, *req.Archived)
+		if err != nil {
+			apiStoreError(w, err)
+			return
+		}
+	}
+	a.writeHabit(w, r, habit.ID)
+}
+
+// Undo handler takes back the latest perform of the habit, if it is recent
+// enough, and returns the habit as it was before
+func (a API) Undo(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.UndoPerform(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// Pause handler pauses the habit over the dates of the request, both included
+func (a API) Pause(w http.ResponseWriter, r *http.Request) {
+	var req pauseRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	from, err := time.Parse(store.DateLayout, req.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "from must be a date like 2021-10-15")
+		return
+	}
+	until, err := time.Parse(store.DateLayout, req.Until)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "until must be a date like 2021-10-15")
+		return
+	}
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.PauseHabit(r.Context(), id, from, until)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// Resume handler ends the running and upcoming pauses of the habit
+func (a API) Resume(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.ResumeHabit(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// Delete handler deletes the habit with its history
+func (a API) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.DeleteHabit(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Perform handler performs the habit, with the amount of the optional body
+// for quantitative habits
+func (a API) Perform(w http.ResponseWriter, r *http.Request) {
+	var req performRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	a.respond(w, r, func(ctx context.Context, habit store.Habit) (string, error) {
+		return a.Store.PerformHabit(ctx, habit, req.Amount)
+	})
+}
+
+// Relapse handler logs a slip on a habit to quit
+func (a API) Relapse(w http.ResponseWriter, r *http.Request) {
+	a.respond(w, r, a.Store.Relapse)
+}
+
+// History handler returns every check-in of the habit, oldest first
+func (a API) History(w http.ResponseWriter, r *http.Request) {
+	habit, err := a.habit(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	history, err := a.Store.History(r.Context(), *habit)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	list := make([]checkInJSON, 0, len(history))
+	for _, c := range history {
+		list = append(list, checkInJSON{ID: c.ID, PerformedAt: c.PerformedAt, Amount: c.Amount})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Stats handler returns the figures of the habit worked out from its history
+func (a API) Stats(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	stats, err := a.Store.Stats(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	j := statsJSON{
+		Streak:        stats.Streak,
+		LongestStreak: stats.LongestStreak,
+		CheckIns:      stats.CheckIns,
+		Total:         stats.Total,
+		PerWeek:       stats.PerWeek,
+		Completion:    make([]completionJSON, 0, len(stats.Completion)),
+	}
+	for _, c := range stats.Completion {
+		j.Completion = append(j.Completion, completionJSON{Days: c.Days, Due: c.Due, Done: c.Done, Rate: c.Rate()})
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// Challenges handler returns every challenge of the habit, newest first
+func (a API) Challenges(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	challenges, err := a.Store.Challenges(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	list := make([]challengeJSON, 0, len(challenges))
+	for _, c := range challenges {
+		list = append(list, newChallengeJSON(c))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// StartChallenge handler takes on a challenge of the habit and returns the
+// habit with it
+func (a API) StartChallenge(w http.ResponseWriter, r *http.Request) {
+	var req challengeRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	var start time.Time
+	if req.Start != "" {
+		var err error
+		start, err = time.Parse(store.DateLayout, req.Start)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "start must be a date like 2021-10-15")
+			return
+		}
+	}
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.StartChallenge(r.Context(), id, start, req.Days)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// AbandonChallenge handler gives up on the running challenge of the habit
+// and returns the habit
+func (a API) AbandonChallenge(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.AbandonChallenge(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// LogCheckIn handler records a check-in of the habit on the day of the
+// request, which may be in the past, and returns the habit with its streaks
+// derived again
+func (a API) LogCheckIn(w http.ResponseWriter, r *http.Request) {
+	var req checkInRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	date, err := time.Parse(store.DateLayout, req.Date)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "date must be a date like 2021-10-15")
+		return
+	}
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	err = a.Store.LogCheckIn(r.Context(), id, date, req.Amount)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// DeleteCheckIn handler removes a check-in from the history of the habit and
+// returns the habit with its streaks derived again
+func (a API) DeleteCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	checkInID, err := strconv.Atoi(chi.URLParam(r, "checkInID"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "check-in not found")
+		return
+	}
+	err = a.Store.DeleteCheckIn(r.Context(), id, checkInID)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	a.writeHabit(w, r, id)
+}
+
+// Spec handler serves the OpenAPI document describing the API
+func (a API) Spec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, err := w.Write(openapi.Spec)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// Authenticate middleware makes the requests of signed-in users, and the ones
+// carrying an API token, act on behalf of the user. Requests without either,
+// or with a token that doesn't work, are turned down rather than served
+// without a user: habits without an owner are only kept by the command-line
+// tool on a local database. Browsers send the session cookie along with
+// requests other sites make, so changes signed in with it must carry the
+// CSRF token of the browser in the X-CSRF-Token header, like forms do.
+func (a API) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user *store.User
+		var err error
+		if header := r.Header.Get("Authorization"); header != "" {
+			token, ok := bearerToken(header)
+			if !ok {
+				unauthorized(w, "Authorization header must be 'Bearer <token>'")
+				return
+			}
+			user, err = a.APITokens.TokenUser(r.Context(), token)
+			if errors.Is(err, store.ErrNotFound) {
+				unauthorized(w, "API token is unknown or revoked")
+				return
+			}
+		} else {
+			user, err = currentUser(r, a.Sessions)
+			if err == nil && user != nil && !safeMethod(r.Method) && !validCSRFToken(csrfCookieToken(r), r.Header.Get(csrfHeader)) {
+				writeError(w, http.StatusForbidden, "forbidden", "requests signed in with the session cookie must carry the CSRF token in an X-CSRF-Token header")
+				return
+			}
+		}
+		if err != nil {
+			apiStoreError(w, err)
+			return
+		}
+		if user == nil {
+			unauthorized(w, "sign in or pass an API token in an Authorization header")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(store.WithUser(r.Context(), user)))
+	})
+}
+
+// respond applies the action to the habit named in the path and returns its
+// massage together with the habit as stored afterwards
+func (a API) respond(w http.ResponseWriter, r *http.Request, action func(context.Context, store.Habit) (string, error)) {
+	habit, err := a.habit(r)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	massage, err := action(r.Context(), *habit)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	habit, err = a.Store.GetHabitByID(r.Context(), habit.ID)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, performResponse{Message: massage, Habit: newHabitJSON(*habit)})
+}
+
+// writeHabit answers with the habit with the ID as it is stored
+func (a API) writeHabit(w http.ResponseWriter, r *http.Request, id int) {
+	habit, err := a.Store.GetHabitByID(r.Context(), id)
+	if err != nil {
+		apiStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newHabitJSON(*habit))
+}
+
+// habit returns the stored habit with the ID in the path
+func (a API) habit(r *http.Request) (*store.Habit, error) {
+	id, err := habitID(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Store.GetHabitByID(r.Context(), id)
+}
+
+// decodeJSON reads the JSON body of the request into v, rejecting bodies
+// without the application/json content type, unknown fields and bodies over
+// maxBodySize. An empty body returns io.EOF.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		if _, err := io.ReadFull(body, make([]byte, 1)); err == nil {
+			return errors.New("request body must have Content-Type application/json")
+		}
+		return fmt.Errorf("request body is empty: %w", io.EOF)
+	}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("request body is empty: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("request body is not valid JSON: %v", err)
+	}
+	return nil
+}
+
+// writeJSON sends v as the JSON body of a response with the status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// writeError sends an error response with the status code, a short code
+// clients can match on and a message for people
+func writeError(w http.ResponseWriter, code int, errorCode, message string) {
+	body := errorJSON{}
+	body.Error.Code = errorCode
+	body.Error.Message = message
+	writeJSON(w, code, body)
+}
+
+// bearerToken returns the token of an Authorization header with the Bearer
+// scheme
+func bearerToken(header string) (string, bool) {
+	parts := strings.Fields(header)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// unauthorized answers requests whose API token doesn't work
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="habits"`)
+	writeError(w, http.StatusUnauthorized, "unauthorized", message)
+}
+
+// apiStoreError maps an error returned by the store to the matching HTTP
+// status and error response
+func apiStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, store.ErrExists):
+		writeError(w, http.StatusConflict, "exists", err.Error())
+	case errors.Is(err, store.ErrInvalid):
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+	case errors.Is(err, context.Canceled):
+		// The client went away, there is nobody left to answer
+		log.Println(err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Println(err.Error())
+		writeError(w, http.StatusServiceUnavailable, "unavailable", "Service Unavailable")
+	default:
+		log.Println(err.Error())
+		writeError(w, http.StatusInternalServerError, "internal", "Internal Server Error")
+	}
+}
@@ -0,0 +1,432 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/miloszizic/habits/store"
+)
+
+func TestAPIListHabits(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go", "piano")
+	rec := serveJSON(t, habits, http.MethodGet, "/api/v1/habits", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/habits status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var got []habitJSON
+	decodeBody(t, rec, &got)
+	if len(got) != 2 || got[0].Name != "Go" || got[1].Name != "piano" {
+		t.Errorf("got habits %+v; want Go and piano", got)
+	}
+	empty, _ := newMemoryStore(t)
+	rec = serveJSON(t, empty, http.MethodGet, "/api/v1/habits", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("got body %s without habits; want []", body)
+	}
+}
+
+func TestAPIGetHabit(t *testing.T) {
+	habits, _ := newMemoryStore(t, "learn Go")
+	rec := serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET habit status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if got.ID != 1 || got.Name != "learn Go" || got.Kind != "build" || got.Schedule != "daily" {
+		t.Errorf("got habit %+v", got)
+	}
+}
+
+func TestAPIListByName(t *testing.T) {
+	habits, _ := newMemoryStore(t, "learn Go", "piano")
+	rec := serveJSON(t, habits, http.MethodGet, "/api/v1/habits?name=learn+Go", "")
+	var list []habitJSON
+	decodeBody(t, rec, &list)
+	if len(list) != 1 || list[0].ID != 1 || list[0].Name != "learn Go" {
+		t.Errorf("got habits %+v; want only learn Go", list)
+	}
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits?name=missing", "")
+	if body := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || body != "[]" {
+		t.Errorf("got status %d and body %s for a missing name; want 200 and []", rec.Code, body)
+	}
+}
+
+func TestAPICreate(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits",
+		`{"name": "read", "description": "a novel a month", "schedule": "mon,wed", "target": 20, "unit": "pages"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/habits status = %d; want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/v1/habits/1" {
+		t.Errorf("got Location %q; want /api/v1/habits/1", got)
+	}
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if got.ID == 0 || got.Name != "read" || got.Description != "a novel a month" || got.Schedule != "mon,wed" || got.Target != 20 || got.Unit != "pages" {
+		t.Errorf("got habit %+v", got)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	tcs := map[string]struct {
+		method, target, body string
+		status               int
+		code                 string
+	}{
+		"duplicate":        {http.MethodPost, "/api/v1/habits", `{"name": "Go"}`, http.StatusConflict, "exists"},
+		"missing name":     {http.MethodPost, "/api/v1/habits", `{"schedule": "daily"}`, http.StatusBadRequest, "invalid"},
+		"invalid schedule": {http.MethodPost, "/api/v1/habits", `{"name": "run", "schedule": "8/week"}`, http.StatusBadRequest, "invalid"},
+		"unknown weekday":  {http.MethodPost, "/api/v1/habits", `{"name": "run", "schedule": "mon,funday"}`, http.StatusBadRequest, "invalid"},
+		"edit schedule":    {http.MethodPatch, "/api/v1/habits/1", `{"schedule": "someday"}`, http.StatusBadRequest, "invalid"},
+		"unknown field":    {http.MethodPost, "/api/v1/habits", `{"name": "run", "color": "red"}`, http.StatusBadRequest, "invalid"},
+		"invalid JSON":     {http.MethodPost, "/api/v1/habits", `{"name": `, http.StatusBadRequest, "invalid"},
+		"missing habit":    {http.MethodGet, "/api/v1/habits/999", "", http.StatusNotFound, "not_found"},
+		"missing history":  {http.MethodGet, "/api/v1/habits/999/history", "", http.StatusNotFound, "not_found"},
+		"missing delete":   {http.MethodDelete, "/api/v1/habits/999", "", http.StatusNotFound, "not_found"},
+		"not an ID":        {http.MethodGet, "/api/v1/habits/Go", "", http.StatusNotFound, "not_found"},
+		"rename to taken":  {http.MethodPatch, "/api/v1/habits/2", `{"name": "Go"}`, http.StatusConflict, "exists"},
+		"relapse to build": {http.MethodPost, "/api/v1/habits/1/relapse", "", http.StatusBadRequest, "invalid"},
+		"no endpoint":      {http.MethodGet, "/api/v1/streaks", "", http.StatusNotFound, "not_found"},
+		"wrong method":     {http.MethodPut, "/api/v1/habits/1", `{}`, http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for name, tc := range tcs {
+		habits, _ := newMemoryStore(t, "Go", "piano")
+		rec := serveJSON(t, habits, tc.method, tc.target, tc.body)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d; want %d", name, rec.Code, tc.status)
+		}
+		var got errorJSON
+		decodeBody(t, rec, &got)
+		if got.Error.Code != tc.code || got.Error.Message == "" {
+			t.Errorf("%s: got error %+v; want code %q with a message", name, got.Error, tc.code)
+		}
+	}
+}
+
+func TestAPIRejectsBodiesThatAreNotJSON(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	req := newJSONRequest(http.MethodPost, "/api/v1/habits", `{"name": "run"}`)
+	req.Header.Set("Content-Type", "text/plain")
+	rec := serveSignedIn(t, habits, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /api/v1/habits as text/plain status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if _, err := habits.GetHabit(asTester(), "run"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("got %v getting the habit posted as text/plain; want ErrNotFound", err)
+	}
+}
+
+func TestAPIUpdate(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	rec := serveJSON(t, habits, http.MethodPatch, "/api/v1/habits/1", `{"name": "golang", "description": "an hour a day", "schedule": "3/week"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH habit status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if got.ID != 1 || got.Name != "golang" || got.Description != "an hour a day" || got.Schedule != "3/week" {
+		t.Errorf("got habit %+v; want golang on 3/week with its description", got)
+	}
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1", "")
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.Name != "golang" {
+		t.Errorf("GET renamed habit by its ID status = %d, name %q; want %d and golang", rec.Code, got.Name, http.StatusOK)
+	}
+}
+
+func TestAPIPauseAndArchive(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/pauses", `{"from": "2021-10-15", "until": "2021-10-17"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST pauses status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if !got.PausedToday || got.DueToday || len(got.Pauses) != 1 || got.Pauses[0].From != "2021-10-15" || got.Pauses[0].Until != "2021-10-17" {
+		t.Errorf("got habit %+v; want it paused today until 2021-10-17", got)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/pauses", `{"from": "2021-10-17", "until": "2021-10-15"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST backward pause status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/pauses", `{"from": "tomorrow", "until": "2021-10-17"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST pause without dates status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	clock.AddDate(0, 0, 1)
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/resume", "")
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.PausedToday || len(got.Pauses) != 1 || got.Pauses[0].Until != "2021-10-15" {
+		t.Errorf("resumed status = %d, habit %+v; want the pause ended yesterday", rec.Code, got)
+	}
+
+	rec = serveJSON(t, habits, http.MethodPatch, "/api/v1/habits/1", `{"archived": true}`)
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.ArchivedAt == nil || !got.ArchivedAt.Equal(clock.Now()) || got.DueToday {
+		t.Errorf("archived status = %d, habit %+v; want it archived now", rec.Code, got)
+	}
+	rec = serveJSON(t, habits, http.MethodPatch, "/api/v1/habits/1", `{"archived": false}`)
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.ArchivedAt != nil {
+		t.Errorf("restored status = %d, habit %+v; want it in use", rec.Code, got)
+	}
+}
+
+func TestAPIBackfill(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 2)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/history", `{"date": "2021-10-16"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST history status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if got.Streak != 1 || got.LongestStreak != 1 || !got.DueToday {
+		t.Errorf("got habit %+v; want yesterday's streak with today still due", got)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/history", `{"date": "yesterday"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST history without a date status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	history, err := habits.History(asTester(), store.Habit{ID: 1})
+	if err != nil || len(history) != 1 {
+		t.Fatalf("got history %+v, %v; want the logged check-in", history, err)
+	}
+	rec = serveJSON(t, habits, http.MethodDelete, "/api/v1/habits/1/history/"+strconv.Itoa(history[0].ID), "")
+	decodeBody(t, rec, &got)
+	if rec.Code != http.StatusOK || got.Streak != 0 {
+		t.Errorf("DELETE check-in status = %d, habit %+v; want the streak gone", rec.Code, got)
+	}
+	rec = serveJSON(t, habits, http.MethodDelete, "/api/v1/habits/1/history/x", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE check-in x status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIDelete(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	rec := serveJSON(t, habits, http.MethodDelete, "/api/v1/habits/1", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE habit status = %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted habit status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIPerformAndHistory(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST perform status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got performResponse
+	decodeBody(t, rec, &got)
+	if !strings.Contains(got.Message, "Nice work") || got.Habit.Streak != 1 || got.Habit.DueToday {
+		t.Errorf("got %+v; want a massage and a streak of 1", got)
+	}
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1/history", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET history status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var history []checkInJSON
+	decodeBody(t, rec, &history)
+	if len(history) != 1 || !history[0].PerformedAt.Equal(clock.Now()) || history[0].Amount != 1 {
+		t.Errorf("got history %+v; want the one check-in", history)
+	}
+}
+
+func TestAPIUndo(t *testing.T) {
+	router := loadSpec(t)
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST perform status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/undo", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST undo status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	validateExchange(t, router, "POST /api/v1/habits/1/undo", "", rec)
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if got.Streak != 0 || !got.DueToday {
+		t.Errorf("got habit %+v; want the perform taken back", got)
+	}
+	for target, want := range map[string]int{
+		"/api/v1/habits/1/undo":   http.StatusBadRequest,
+		"/api/v1/habits/999/undo": http.StatusNotFound,
+	} {
+		rec = serveJSON(t, habits, http.MethodPost, target, "")
+		if rec.Code != want {
+			t.Errorf("POST %s status = %d; want %d", target, rec.Code, want)
+		}
+		validateExchange(t, router, "POST "+target, "", rec)
+	}
+}
+
+func TestAPIStats(t *testing.T) {
+	router := loadSpec(t)
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST perform status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	clock.AddDate(0, 0, 2)
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1/stats", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET stats status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	validateExchange(t, router, "GET /api/v1/habits/1/stats", "", rec)
+	var got statsJSON
+	decodeBody(t, rec, &got)
+	if got.CheckIns != 1 || got.LongestStreak != 1 || len(got.Completion) != 4 {
+		t.Fatalf("got stats %+v; want the one check-in and four completion rates", got)
+	}
+	if c := got.Completion[0]; c.Days != 7 || c.Due != 2 || c.Done != 1 || c.Rate != 0.5 {
+		t.Errorf("got completion %+v; want 1 of 2 days over the last 7", c)
+	}
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/999/stats", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET stats of a missing habit status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	validateExchange(t, router, "GET /api/v1/habits/999/stats", "", rec)
+}
+
+func TestAPIChallenges(t *testing.T) {
+	router := loadSpec(t)
+	habits, clock := newMemoryStore(t, "Go")
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/challenges", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST challenges status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	validateExchange(t, router, "POST /api/v1/habits/1/challenges", "", rec)
+	var got habitJSON
+	decodeBody(t, rec, &got)
+	if c := got.Challenge; c == nil || c.Start != "2021-10-16" || c.End != "2021-11-14" || c.Days != 30 || c.Outcome != "running" || c.Day != 0 {
+		t.Fatalf("got challenge %+v; want a running 30-day challenge from the day after the habit was added", got.Challenge)
+	}
+	body := `{"start": "2021-10-16", "days": 7}`
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/challenges", body)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST a second challenge status = %d; want %d", rec.Code, http.StatusConflict)
+	}
+	validateExchange(t, router, "POST /api/v1/habits/1/challenges", body, rec)
+	clock.AddDate(0, 0, 1)
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/challenges/abandon", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST abandon status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	validateExchange(t, router, "POST /api/v1/habits/1/challenges/abandon", "", rec)
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/challenges", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST challenges status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	clock.AddDate(0, 0, 1)
+	rec = serveJSON(t, habits, http.MethodGet, "/api/v1/habits/1/challenges", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET challenges status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	validateExchange(t, router, "GET /api/v1/habits/1/challenges", "", rec)
+	var list []challengeJSON
+	decodeBody(t, rec, &list)
+	if len(list) != 2 || list[0].Start != "2021-10-16" || list[0].Outcome != "failed" || list[1].Outcome != "abandoned" ||
+		list[1].AbandonedOn == nil || *list[1].AbandonedOn != "2021-10-16" {
+		t.Errorf("got challenges %+v; want the failed 7-day one, then the abandoned one", list)
+	}
+	for target, want := range map[string]int{
+		"/api/v1/habits/1/challenges/abandon": http.StatusBadRequest,
+		"/api/v1/habits/999/challenges":       http.StatusNotFound,
+	} {
+		rec = serveJSON(t, habits, http.MethodPost, target, "")
+		if rec.Code != want {
+			t.Errorf("POST %s status = %d; want %d", target, rec.Code, want)
+		}
+		validateExchange(t, router, "POST "+target, "", rec)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/challenges", `{"start": "soon"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST challenges with a bad start status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIPerformQuantitativeHabit(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits", `{"name": "read", "target": 20, "unit": "pages"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/habits status = %d; want %d", rec.Code, http.StatusCreated)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", `{"amount": 5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST perform status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got performResponse
+	decodeBody(t, rec, &got)
+	if got.Habit.Progress != 5 || !got.Habit.DueToday {
+		t.Errorf("got %+v; want progress 5 and still due", got.Habit)
+	}
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST perform without amount status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIRelapse(t *testing.T) {
+	habits, clock := newMemoryStore(t)
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits", `{"name": "sugar", "kind": "quit"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/habits status = %d; want %d", rec.Code, http.StatusCreated)
+	}
+	clock.AddDate(0, 0, 4)
+	rec = serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/relapse", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST relapse status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got performResponse
+	decodeBody(t, rec, &got)
+	if !strings.Contains(got.Message, "after 4 days") || got.Habit.Streak != 0 || got.Habit.Kind != "quit" {
+		t.Errorf("got %+v; want a relapse after 4 days", got)
+	}
+}
+
+func TestAPIStoreFailureIsInternalServerError(t *testing.T) {
+	rec := serveJSON(t, failingStore{}, http.MethodGet, "/api/v1/habits", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /api/v1/habits status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+	var got errorJSON
+	decodeBody(t, rec, &got)
+	if got.Error.Code != "internal" || strings.Contains(got.Error.Message, errFailing.Error()) {
+		t.Errorf("got error %+v; want an internal error that hides the cause", got.Error)
+	}
+}
+
+// serveJSON sends a request with the JSON body, if any, to the service,
+// signed in as the tester
+func serveJSON(t *testing.T, habits store.Store, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveSignedIn(t, habits, newJSONRequest(method, target, body))
+}
+
+// decodeBody reads the JSON response body into v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want application/json", got)
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body, err)
+	}
+}
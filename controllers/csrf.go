@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// csrfCookie is the name of the cookie holding the CSRF token of the browser
+	csrfCookie = "csrf"
+	// csrfField is the name of the form field posting the CSRF token back
+	csrfField = "csrf_token"
+	// csrfHeader is the name of the header sending the CSRF token back with
+	// API requests signed in with the session cookie
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfKey is the context key of the CSRF token of the request
+type csrfKey struct{}
+
+// CSRF middleware turns down form posts that don't carry the CSRF token of
+// the browser, so that pages of other sites can't post forms on behalf of the
+// user. The token is kept in a cookie, which other sites can't read, and
+// handed to the templates through views.Data.
+func CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := csrfCookieToken(r)
+		if token == "" {
+			var err error
+			token, err = newCSRFToken()
+			if err != nil {
+				storeError(w, err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				Secure:   secureRequest(r),
+			})
+		}
+		if !safeMethod(r.Method) && !validCSRFToken(token, r.PostFormValue(csrfField)) {
+			http.Error(w, "Forbidden - CSRF token is missing or invalid", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
+
+// csrfCookieToken returns the CSRF token in the cookie of the browser, if any
+func csrfCookieToken(r *http.Request) string {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// csrfToken returns the CSRF token of the request, for the forms of its page
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// newCSRFToken returns a fresh random CSRF token
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to create CSRF token with error: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validCSRFToken reports whether the posted token is the one of the browser
+func validCSRFToken(token, posted string) bool {
+	return posted != "" && subtle.ConstantTimeCompare([]byte(token), []byte(posted)) == 1
+}
+
+// safeMethod reports whether requests with the method only read and so need
+// no CSRF token
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFormPostsNeedTheCSRFToken(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	tcs := map[string]struct {
+		form   url.Values
+		cookie bool
+	}{
+		"missing token":      {url.Values{csrfField: {""}}, true},
+		"wrong token":        {url.Values{csrfField: {"forged"}}, true},
+		"token of no cookie": {nil, false},
+	}
+	for name, tc := range tcs {
+		req := newFormRequest(http.MethodPost, "/habits/1/delete", tc.form)
+		if !tc.cookie {
+			req.Header.Del("Cookie")
+		}
+		rec := serveSignedIn(t, habits, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: POST /habits/1/delete status = %d; want %d", name, rec.Code, http.StatusForbidden)
+		}
+	}
+	if _, err := habits.GetHabit(asTester(), "Go"); err != nil {
+		t.Fatalf("habit is gone after posts without the CSRF token: %v", err)
+	}
+	rec := serve(t, habits, http.MethodPost, "/habits/1/delete", nil)
+	if rec.Code == http.StatusForbidden {
+		t.Errorf("POST /habits/1/delete with the CSRF token status = %d", rec.Code)
+	}
+}
+
+func TestFormsCarryTheCSRFToken(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	rec := httptest.NewRecorder()
+	Service(habits).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	var token string
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == csrfCookie {
+			token = cookie.Value
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("got CSRF cookie %+v; want it HttpOnly and SameSite=Lax", cookie)
+			}
+		}
+	}
+	if token == "" {
+		t.Fatal("GET /login without a CSRF cookie does not set one")
+	}
+	if !strings.Contains(rec.Body.String(), `name="csrf_token" value="`+token+`"`) {
+		t.Errorf("login form is missing the CSRF token: %s", rec.Body)
+	}
+
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	forms := strings.Count(rec.Body.String(), `method="post"`)
+	tokens := strings.Count(rec.Body.String(), `name="csrf_token" value="`+testCSRFToken+`"`)
+	if forms == 0 || tokens != forms {
+		t.Errorf("home page has %d forms posting and %d CSRF tokens; want one in each form", forms, tokens)
+	}
+}
+
+func TestAPIChangesWithTheSessionCookieNeedTheCSRFToken(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	tcs := map[string]func(*http.Request){
+		"missing token": func(r *http.Request) { r.Header.Del(csrfHeader) },
+		"wrong token":   func(r *http.Request) { r.Header.Set(csrfHeader, "forged") },
+		"token of no cookie": func(r *http.Request) {
+			r.Header.Del("Cookie")
+		},
+	}
+	for name, change := range tcs {
+		// Like a form of another site posting plain text
+		req := newJSONRequest(http.MethodPost, "/api/v1/habits/1/perform", `{"amount": 1}`)
+		req.Header.Set("Content-Type", "text/plain")
+		change(req)
+		rec := serveSignedIn(t, habits, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: POST /api/v1/habits/1/perform status = %d; want %d", name, rec.Code, http.StatusForbidden)
+		}
+	}
+	habit, err := habits.GetHabit(asTester(), "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Streak != 0 {
+		t.Errorf("got streak %d after posts without the CSRF token; want 0", habit.Streak)
+	}
+	rec := serveJSON(t, habits, http.MethodPost, "/api/v1/habits/1/perform", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("POST /api/v1/habits/1/perform with the CSRF token status = %d; want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"github.com/miloszizic/habits/openapi"
+)
+
+func TestOpenAPISpecIsServed(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serveJSON(t, habits, http.MethodGet, "/api/v1/openapi.yaml", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.yaml status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), openapi.Spec) {
+		t.Error("served document differs from the embedded one")
+	}
+	loadSpec(t)
+}
+
+// TestAPIMatchesOpenAPISpec sends requests covering every operation and
+// checks both the requests and the responses of the handlers against the spec
+func TestAPIMatchesOpenAPISpec(t *testing.T) {
+	router := loadSpec(t)
+	habits, clock := newMemoryStore(t, "Go")
+	exchanges := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/api/v1/habits", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/habits", `{"name": "read", "description": "a novel a month", "schedule": "mon,fri", "target": 20, "unit": "pages"}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/habits", `{"name": "sugar", "kind": "quit"}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/habits", `{"name": "Go"}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/habits", `{"name": "run", "schedule": "9/week"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/habits?name=read", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/habits/1", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/habits/999", "", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/habits/1/perform", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/2/perform", `{"amount": 5}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/3/perform", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/3/relapse", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/1/relapse", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/habits/1/history", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/1/history", `{"date": "2021-10-28"}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/1/history", `{"date": "2021-10-28"}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/habits/1/history", `{"date": "2021-12-01"}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/habits/1/history/4", "", http.StatusOK},
+		{http.MethodDelete, "/api/v1/habits/1/history/4", "", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/habits/1/pauses", `{"from": "2021-10-30", "until": "2021-11-02"}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/3/pauses", `{"from": "2021-10-30", "until": "2021-11-02"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/habits/999/pauses", `{"from": "2021-10-30", "until": "2021-11-02"}`, http.StatusNotFound},
+		{http.MethodPost, "/api/v1/habits/1/resume", "", http.StatusOK},
+		{http.MethodPatch, "/api/v1/habits/2", `{"archived": true}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/habits/2/perform", `{"amount": 5}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/v1/habits/1", `{"name": "golang", "description": "an hour a day", "schedule": "3/week"}`, http.StatusOK},
+		{http.MethodPatch, "/api/v1/habits/1", `{"name": "read"}`, http.StatusConflict},
+		{http.MethodGet, "/api/v1/habits", "", http.StatusOK},
+		{http.MethodDelete, "/api/v1/habits/1", "", http.StatusNoContent},
+		{http.MethodDelete, "/api/v1/habits/1", "", http.StatusNotFound},
+	}
+	for _, ex := range exchanges {
+		clock.AddDate(0, 0, 1)
+		name := ex.method + " " + ex.target
+		rec := serveSignedIn(t, habits, newJSONRequest(ex.method, ex.target, ex.body))
+		if rec.Code != ex.status {
+			t.Errorf("%s: status = %d; want %d: %s", name, rec.Code, ex.status, rec.Body)
+		}
+		validateExchange(t, router, name, ex.body, rec)
+	}
+}
+
+func TestAPIErrorsMatchOpenAPISpec(t *testing.T) {
+	router := loadSpec(t)
+	rec := serveJSON(t, failingStore{}, http.MethodGet, "/api/v1/habits", "")
+	validateExchange(t, router, "GET /api/v1/habits", "", rec)
+}
+
+// loadSpec loads and validates the OpenAPI document and returns a router
+// finding its operations
+func loadSpec(t *testing.T) routers.Router {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec)
+	if err != nil {
+		t.Fatalf("loading the OpenAPI document: %v", err)
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		t.Fatalf("OpenAPI document is invalid: %v", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// validateExchange checks the request named like "GET /path" with the body,
+// and the recorded response to it, against the OpenAPI document
+func validateExchange(t *testing.T, router routers.Router, name, body string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	fields := strings.SplitN(name, " ", 2)
+	req := newJSONRequest(fields[0], fields[1], body)
+	route, params, err := router.FindRoute(req)
+	if err != nil {
+		t.Errorf("%s: the OpenAPI document has no operation: %v", name, err)
+		return
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	ctx := context.Background()
+	if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+		t.Errorf("%s: request does not match the OpenAPI document: %v", name, err)
+	}
+	err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.Code,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		t.Errorf("%s: response does not match the OpenAPI document: %v", name, err)
+	}
+}
+
+// newJSONRequest returns a request with the JSON body, if any
+func newJSONRequest(method, target, body string) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	req.Header.Set(csrfHeader, testCSRFToken)
+	return req
+}
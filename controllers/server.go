@@ -2,13 +2,15 @@ package controllers
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,95 +23,712 @@ import (
 
 type Server struct {
 	Store     store.HabitStore
+	Users     store.UserStore
+	Sessions  store.SessionStore
+	APITokens store.TokenStore
 	Templates struct {
 		New Template
 	}
-	Data views.Data
+}
+
+// homePage is the home page with the habits in use, and the archived ones
+// below them
+type homePage struct {
+	Habits   []store.Habit
+	Archived []store.Habit
 }
 
 // Home handler is handling the home page
-func (s Server) Home(w http.ResponseWriter, _ *http.Request) {
-	habits, err := s.Store.AllHabits()
+func (s Server) Home(w http.ResponseWriter, r *http.Request) {
+	habits, err := s.Store.AllHabits(r.Context())
 	if err != nil {
-		log.Println(err.Error())
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	var page homePage
+	for _, habit := range habits {
+		if habit.Archived() {
+			page.Archived = append(page.Archived, habit)
+		} else {
+			page.Habits = append(page.Habits, habit)
+		}
+	}
 
+	data := newData(r)
+	data.Yield = page
 	s.Templates.New = views.Must(views.ParseFS(templates.Files, "home.gohtml", "*.layout.gohtml"))
-	s.Templates.New.Execute(w, habits)
+	s.Templates.New.Execute(w, data)
 
 }
 
 // Habit handler handles the get method for add habit page
-func (s Server) Habit(w http.ResponseWriter, _ *http.Request) {
+func (s Server) Habit(w http.ResponseWriter, r *http.Request) {
 	s.Templates.New = views.Must(views.ParseFS(templates.Files, "habit.gohtml", "*.layout.gohtml"))
-	s.Templates.New.Execute(w, nil)
+	s.Templates.New.Execute(w, newData(r))
 }
 
 // Create handler creates new habit or files with user alert
 func (s Server) Create(w http.ResponseWriter, r *http.Request) {
 	habitName := r.FormValue("name")
-	habit := store.Habit{Name: habitName}
+	data := newData(r)
 	s.Templates.New = views.Must(views.ParseFS(templates.Files, "habit.gohtml", "*.layout.gohtml"))
-	exist, err := s.Store.GetHabit(habitName)
-	if errors.Unwrap(err) == sql.ErrNoRows || exist == nil {
-		s.Data.Alert = &views.Alert{
+	schedule, err := scheduleFromForm(r)
+	if err != nil {
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: err.Error(),
+		}
+		writeStatus(w, http.StatusBadRequest)
+		s.Templates.New.Execute(w, data)
+		return
+	}
+	target, err := amountFromForm(r, "target")
+	if err != nil {
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: err.Error(),
+		}
+		writeStatus(w, http.StatusBadRequest)
+		s.Templates.New.Execute(w, data)
+		return
+	}
+	habit := store.Habit{
+		Name:        habitName,
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Kind:        store.Kind(r.FormValue("kind")),
+		Schedule:    schedule,
+		Target:      target,
+		Unit:        strings.TrimSpace(r.FormValue("unit")),
+	}
+	err = s.Store.Add(r.Context(), habit)
+	switch {
+	case errors.Is(err, store.ErrExists):
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: "Habit already exists",
+		}
+		writeStatus(w, http.StatusConflict)
+	case errors.Is(err, store.ErrInvalid):
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: err.Error(),
+		}
+		writeStatus(w, http.StatusBadRequest)
+	case err != nil:
+		storeError(w, err)
+		return
+	default:
+		data.Alert = &views.Alert{
 			Color:   views.AlertLvlSuccess,
 			Message: fmt.Sprintf("You successfully created a %s Habit", habitName),
 		}
-		s.Store.Add(habit)
-		s.Templates.New.Execute(w, s.Data)
 	}
-	if exist != nil {
-		s.Data.Alert = &views.Alert{
+	s.Templates.New.Execute(w, data)
+}
+
+// detailPage is the page of the habit with the figures worked out from its
+// history, the heatmap of its last year and its challenges, newest first
+type detailPage struct {
+	Habit       store.Habit
+	Stats       store.Stats
+	Heatmap     template.HTML
+	Challenges  []store.Challenge
+	DefaultDays int
+}
+
+// Detail handler shows the habit with its streaks, totals and completion
+// rates
+func (s Server) Detail(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	page, err := s.detailPage(r, *habit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	data.Yield = page
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "detail.gohtml", "*.layout.gohtml"))
+	s.Templates.New.Execute(w, data)
+}
+
+// detailPage returns the page of the habit with its figures and challenges
+func (s Server) detailPage(r *http.Request, habit store.Habit) (detailPage, error) {
+	page := detailPage{Habit: habit, DefaultDays: store.DefaultChallengeDays}
+	stats, err := s.Store.Stats(r.Context(), habit.ID)
+	if err != nil {
+		return page, err
+	}
+	page.Stats = *stats
+	page.Heatmap = views.Heatmap(habit, stats.Year)
+	page.Challenges, err = s.Store.Challenges(r.Context(), habit.ID)
+	return page, err
+}
+
+// StartChallenge handler takes on a challenge of the habit from the day and
+// over the days of the form and returns to its page, or fails with user
+// alert
+func (s Server) StartChallenge(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = challengeFromForm(r, s.Store, habit.ID)
+	s.backToDetail(w, r, *habit, err)
+}
+
+// AbandonChallenge handler gives up on the running challenge of the habit
+// and returns to its page
+func (s Server) AbandonChallenge(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = s.Store.AbandonChallenge(r.Context(), habit.ID)
+	s.backToDetail(w, r, *habit, err)
+}
+
+// backToDetail returns to the page of the habit after a change to its
+// challenges, or shows the page again with an alert when the change was
+// invalid
+func (s Server) backToDetail(w http.ResponseWriter, r *http.Request, habit store.Habit, err error) {
+	var status int
+	switch {
+	case err == nil:
+		http.Redirect(w, r, detailPath(habit.ID), http.StatusSeeOther)
+		return
+	case errors.Is(err, store.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, store.ErrExists):
+		status = http.StatusConflict
+	default:
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	page, pageErr := s.detailPage(r, habit)
+	if pageErr != nil {
+		storeError(w, pageErr)
+		return
+	}
+	data.Yield = page
+	data.Alert = &views.Alert{
+		Color:   views.AlertLvlError,
+		Message: err.Error(),
+	}
+	writeStatus(w, status)
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "detail.gohtml", "*.layout.gohtml"))
+	s.Templates.New.Execute(w, data)
+}
+
+// editPage is the edit habit page of the habit, with the weekdays of its
+// schedule to pick from and its latest check-ins, newest first
+type editPage struct {
+	Habit    store.Habit
+	Weekdays []weekdayOption
+	CheckIns []store.CheckIn
+}
+
+// recentCheckIns is how many of the latest check-ins the edit page lists
+const recentCheckIns = 10
+
+// weekdayOption is a day of the week in the schedule picker
+type weekdayOption struct {
+	Value   string
+	Label   string
+	Checked bool
+}
+
+// newEditPage returns the edit habit page of the habit
+func newEditPage(habit store.Habit) editPage {
+	page := editPage{Habit: habit}
+	for day := 1; day <= 7; day++ {
+		weekday := time.Weekday(day % 7)
+		label := weekday.String()[:3]
+		page.Weekdays = append(page.Weekdays, weekdayOption{
+			Value:   strings.ToLower(label),
+			Label:   label,
+			Checked: page.OnWeekdays() && habit.Schedule.On(weekday),
+		})
+	}
+	return page
+}
+
+// editPage returns the edit habit page of the habit with its latest
+// check-ins
+func (s Server) editPage(r *http.Request, habit store.Habit) (editPage, error) {
+	page := newEditPage(habit)
+	history, err := s.Store.History(r.Context(), habit)
+	if err != nil {
+		return page, err
+	}
+	for i := len(history) - 1; i >= 0 && len(page.CheckIns) < recentCheckIns; i-- {
+		page.CheckIns = append(page.CheckIns, history[i])
+	}
+	return page, nil
+}
+
+// OnWeekdays reports whether the habit is scheduled on fixed days of the week
+func (p editPage) OnWeekdays() bool {
+	return !p.Habit.Schedule.Daily() && !p.Habit.Schedule.Weekly()
+}
+
+// Edit handler handles the get method for the edit habit page
+func (s Server) Edit(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	data.Yield, err = s.editPage(r, *habit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "edit.gohtml", "*.layout.gohtml"))
+	s.Templates.New.Execute(w, data)
+}
+
+// Update handler changes the habit as edited on its page, keeping its ID and
+// history, or fails with user alert
+func (s Server) Update(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "edit.gohtml", "*.layout.gohtml"))
+	changes, err := habitFromForm(r, *habit)
+	page, pageErr := s.editPage(r, changes)
+	if pageErr != nil {
+		storeError(w, pageErr)
+		return
+	}
+	data.Yield = page
+	if err != nil {
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: err.Error(),
+		}
+		writeStatus(w, http.StatusBadRequest)
+		s.Templates.New.Execute(w, data)
+		return
+	}
+	err = s.Store.UpdateHabit(r.Context(), changes)
+	switch {
+	case errors.Is(err, store.ErrExists):
+		data.Alert = &views.Alert{
 			Color:   views.AlertLvlError,
 			Message: "Habit already exists",
 		}
-		s.Templates.New.Execute(w, s.Data)
+		writeStatus(w, http.StatusConflict)
+	case errors.Is(err, store.ErrInvalid):
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlError,
+			Message: err.Error(),
+		}
+		writeStatus(w, http.StatusBadRequest)
+	case err != nil:
+		storeError(w, err)
+		return
+	default:
+		habit, err = s.Store.GetHabitByID(r.Context(), habit.ID)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			storeError(w, err)
+			return
+		}
+		data.Yield, err = s.editPage(r, *habit)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		data.Alert = &views.Alert{
+			Color:   views.AlertLvlSuccess,
+			Message: fmt.Sprintf("You successfully updated the %s Habit", habit.Name),
 		}
 	}
+	s.Templates.New.Execute(w, data)
 }
 
-// Delete handler deletes the habit
+// Delete handler deletes the habit and returns to the home page
 func (s *Server) Delete(w http.ResponseWriter, r *http.Request) {
-	habitName := r.FormValue("delete")
-	err := s.Store.DeleteHabitByName(habitName)
+	id, err := habitID(r)
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		storeError(w, err)
+		return
 	}
-	habits, err := s.Store.AllHabits()
+	err = s.Store.DeleteHabit(r.Context(), id)
 	if err != nil {
-		log.Println(err.Error())
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
 
-	s.Templates.New = views.Must(views.ParseFS(templates.Files, "home.gohtml", "*.layout.gohtml"))
-	s.Templates.New.Execute(w, habits)
+// Pause handler pauses the habit over the dates of the pause form and
+// returns to its edit page, or fails with user alert
+func (s Server) Pause(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = pauseFromForm(r, s.Store, habit.ID)
+	s.backToEdit(w, r, *habit, err)
+}
+
+// LogCheckIn handler records a check-in of the habit on the day of the form,
+// which may be in the past, and returns to its edit page, or fails with user
+// alert
+func (s Server) LogCheckIn(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = checkInFromForm(r, s.Store, habit.ID)
+	s.backToEdit(w, r, *habit, err)
+}
+
+// DeleteCheckIn handler removes a check-in of the habit and returns to its
+// edit page, or fails with user alert
+func (s Server) DeleteCheckIn(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	checkInID, err := strconv.Atoi(chi.URLParam(r, "checkInID"))
+	if err != nil {
+		http.Error(w, "Check-in not found", http.StatusNotFound)
+		return
+	}
+	err = s.Store.DeleteCheckIn(r.Context(), habit.ID, checkInID)
+	s.backToEdit(w, r, *habit, err)
+}
+
+// backToEdit returns to the edit page of the habit after a change to it, or
+// shows the page again with an alert when the change was invalid or clashes
+// with the history
+func (s Server) backToEdit(w http.ResponseWriter, r *http.Request, habit store.Habit, err error) {
+	var status int
+	switch {
+	case err == nil:
+		http.Redirect(w, r, editPath(habit.ID), http.StatusSeeOther)
+		return
+	case errors.Is(err, store.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, store.ErrExists):
+		status = http.StatusConflict
+	default:
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	page, pageErr := s.editPage(r, habit)
+	if pageErr != nil {
+		storeError(w, pageErr)
+		return
+	}
+	data.Yield = page
+	data.Alert = &views.Alert{
+		Color:   views.AlertLvlError,
+		Message: err.Error(),
+	}
+	writeStatus(w, status)
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "edit.gohtml", "*.layout.gohtml"))
+	s.Templates.New.Execute(w, data)
+}
+
+// Resume handler ends the running and upcoming pauses of the habit and
+// returns to its edit page
+func (s Server) Resume(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = s.Store.ResumeHabit(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	http.Redirect(w, r, editPath(id), http.StatusSeeOther)
+}
+
+// Archive handler archives the habit and returns to the home page
+func (s Server) Archive(w http.ResponseWriter, r *http.Request) {
+	s.archive(w, r, true)
+}
+
+// Restore handler brings an archived habit back to the home page
+func (s Server) Restore(w http.ResponseWriter, r *http.Request) {
+	s.archive(w, r, false)
+}
+
+// archive archives or restores the habit with the ID in the path
+func (s Server) archive(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, err := habitID(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = s.Store.ArchiveHabit(r.Context(), id, archived)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// performPage is the data of the page shown after performing a habit
+type performPage struct {
+	Habit    store.Habit
+	Undoable bool
 }
 
 // PerformHabit handler performs the habit and return a massage
 func (s *Server) PerformHabit(w http.ResponseWriter, r *http.Request) {
-	habitName := r.FormValue("perform")
-	habit, err := s.Store.GetHabit(habitName)
+	habit, err := s.habit(r)
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		storeError(w, err)
+		return
+	}
+	amount, err := amountFromForm(r, "amount")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	days := s.Store.LastCheckDays(*habit)
-	massage := s.Store.PerformHabit(*habit, days)
-	s.Data.Alert = &views.Alert{
+	massage, err := s.Store.PerformHabit(r.Context(), *habit, amount)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	performed, err := s.Store.GetHabitByID(r.Context(), habit.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	data.Alert = &views.Alert{
 		Color:   views.AlertLvlNeutral,
 		Message: massage,
 	}
+	data.Yield = performPage{
+		Habit: *performed,
+		// Only a perform that recorded a check-in has something to undo
+		Undoable: !performed.LastPerformed.Equal(habit.LastPerformed),
+	}
 	s.Templates.New = views.Must(views.ParseFS(templates.Files, "perform.gohtml", "*.layout.gohtml"))
-	s.Templates.New.Execute(w, s.Data)
+	s.Templates.New.Execute(w, data)
+}
+
+// Undo handler takes back the latest perform of the habit, if it is recent
+// enough, and returns to the habits
+func (s *Server) Undo(w http.ResponseWriter, r *http.Request) {
+	id, err := habitID(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	err = s.Store.UndoPerform(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
-func RunHTTP() {
+
+// Relapse handler logs a slip on a habit to quit and return a massage
+func (s *Server) Relapse(w http.ResponseWriter, r *http.Request) {
+	habit, err := s.habit(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	massage, err := s.Store.Relapse(r.Context(), *habit)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data := newData(r)
+	data.Alert = &views.Alert{
+		Color:   views.AlertLvlNeutral,
+		Message: massage,
+	}
+	s.Templates.New = views.Must(views.ParseFS(templates.Files, "relapse.gohtml", "*.layout.gohtml"))
+	s.Templates.New.Execute(w, data)
+}
+
+// habit returns the stored habit with the ID in the path
+func (s *Server) habit(r *http.Request) (*store.Habit, error) {
+	id, err := habitID(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.GetHabitByID(r.Context(), id)
+}
+
+// habitID returns the habit ID from the path. IDs that are not numbers
+// can't belong to any habit.
+func habitID(r *http.Request) (int, error) {
+	param := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find Habit %q: %w", param, store.ErrNotFound)
+	}
+	return id, nil
+}
+
+// editPath returns the path of the edit page of the habit with the ID
+func editPath(id int) string {
+	return "/habits/" + strconv.Itoa(id) + "/edit"
+}
+
+// detailPath returns the path of the page of the habit with the ID
+func detailPath(id int) string {
+	return "/habits/" + strconv.Itoa(id)
+}
+
+// pauseFromForm pauses the habit with the ID over the dates of the pause
+// form. Dates that can't be read are invalid.
+func pauseFromForm(r *http.Request, habits store.HabitStore, id int) error {
+	from, err := time.Parse(store.DateLayout, r.FormValue("from"))
+	if err != nil {
+		return fmt.Errorf("first paused day must be a date: %w", store.ErrInvalid)
+	}
+	until, err := time.Parse(store.DateLayout, r.FormValue("until"))
+	if err != nil {
+		return fmt.Errorf("last paused day must be a date: %w", store.ErrInvalid)
+	}
+	return habits.PauseHabit(r.Context(), id, from, until)
+}
+
+// challengeFromForm takes on a challenge of the habit with the ID from the
+// day of the challenge form, today when left empty, over its days
+func challengeFromForm(r *http.Request, habits store.HabitStore, id int) error {
+	var start time.Time
+	if value := r.FormValue("start"); value != "" {
+		var err error
+		start, err = time.Parse(store.DateLayout, value)
+		if err != nil {
+			return fmt.Errorf("first day of the challenge must be a date: %w", store.ErrInvalid)
+		}
+	}
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil {
+		return fmt.Errorf("days of the challenge must be a whole number: %w", store.ErrInvalid)
+	}
+	return habits.StartChallenge(r.Context(), id, start, days)
+}
+
+// checkInFromForm logs a check-in of the habit with the ID on the day of
+// the check-in form, with its amount for habits with a target
+func checkInFromForm(r *http.Request, habits store.HabitStore, id int) error {
+	date, err := time.Parse(store.DateLayout, r.FormValue("date"))
+	if err != nil {
+		return fmt.Errorf("day of the check-in must be a date: %w", store.ErrInvalid)
+	}
+	amount, err := amountFromForm(r, "amount")
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), store.ErrInvalid)
+	}
+	return habits.LogCheckIn(r.Context(), id, date, amount)
+}
+
+// habitFromForm returns the habit with the attributes of the edit habit form.
+// Habits to quit have no schedule or target to read.
+func habitFromForm(r *http.Request, habit store.Habit) (store.Habit, error) {
+	habit.Name = r.FormValue("name")
+	habit.Description = strings.TrimSpace(r.FormValue("description"))
+	if habit.Quitting() {
+		return habit, nil
+	}
+	schedule, err := scheduleFromForm(r)
+	if err != nil {
+		return habit, err
+	}
+	target, err := amountFromForm(r, "target")
+	if err != nil {
+		return habit, err
+	}
+	habit.Schedule = schedule
+	habit.Target = target
+	habit.Unit = strings.TrimSpace(r.FormValue("unit"))
+	return habit, nil
+}
+
+// scheduleFromForm reads the schedule of a habit from the add habit form:
+// every day, on the checked weekdays, or a number of times per week
+func scheduleFromForm(r *http.Request) (store.Schedule, error) {
+	switch r.FormValue("schedule") {
+	case "weekdays":
+		err := r.ParseForm()
+		if err != nil {
+			return store.Schedule{}, err
+		}
+		if len(r.Form["weekday"]) == 0 {
+			return store.Schedule{}, fmt.Errorf("pick at least one weekday for the schedule: %w", store.ErrInvalid)
+		}
+		return store.ParseSchedule(strings.Join(r.Form["weekday"], ","))
+	case "weekly":
+		return store.ParseSchedule(r.FormValue("per_week") + "/week")
+	}
+	return store.Schedule{}, nil
+}
+
+// amountFromForm reads an optional number from the form, zero when empty
+func amountFromForm(r *http.Request, field string) (float64, error) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", field)
+	}
+	return amount, nil
+}
+
+// storeError maps an error returned by the store to the matching HTTP status
+func storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Habit not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrExists):
+		http.Error(w, "Habit already exists", http.StatusConflict)
+	case errors.Is(err, store.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, context.Canceled):
+		// The client went away, there is nobody left to answer
+		log.Println(err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Println(err.Error())
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	default:
+		log.Println(err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// writeStatus sends a non-200 status ahead of a rendered template
+func writeStatus(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+}
+
+// RunHTTP serves the habits web interface from the given store on the
+// address until the process is interrupted
+func RunHTTP(habits store.Store, addr string) {
 	// THe http server
-	server := &http.Server{Addr: ":3000", Handler: service()}
+	server := &http.Server{Addr: addr, Handler: Service(habits)}
 	fmt.Printf("started habit service on port %v\n", server.Addr)
 	//// Trying to set k8s core maxprocs
 	//if _, err := maxprocs.Set(); err != nil {
@@ -126,7 +745,8 @@ func RunHTTP() {
 		<-sig
 
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
@@ -154,21 +774,52 @@ func RunHTTP() {
 
 }
 
-func service() http.Handler {
-	store, err := store.FromSQLite("./habits.db")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "opening %q database: %v\n", err, store)
-		os.Exit(1)
-	}
+// Service returns the handler of the web interface and the JSON API
+func Service(habits store.Store) http.Handler {
 	r := chi.NewRouter()
-	srv := Server{Store: store}
+	srv := Server{Store: habits, Users: habits, Sessions: habits, APITokens: habits}
+
+	r.Mount("/api/v1", API{Store: habits, Sessions: habits, APITokens: habits}.Routes())
+
+	r.Group(func(r chi.Router) {
+		r.Use(CSRF)
+		r.Use(srv.Authenticate)
+
+		r.Get("/signup", srv.SignupForm)
+		r.Post("/signup", srv.Signup)
+		r.Get("/login", srv.LoginForm)
+		r.Post("/login", srv.Login)
+		r.Post("/logout", srv.Logout)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireUser)
+
+			r.Post("/logout/all", srv.LogoutEverywhere)
+			r.Get("/", srv.Home)
+			r.Get("/habits/{id}", srv.Detail)
+			r.Get("/habits/{id}/edit", srv.Edit)
+			r.Post("/habits/{id}/edit", srv.Update)
+			r.Post("/habits/{id}/perform", srv.PerformHabit)
+			r.Post("/habits/{id}/undo", srv.Undo)
+			r.Post("/habits/{id}/relapse", srv.Relapse)
+			r.Post("/habits/{id}/delete", srv.Delete)
+			r.Post("/habits/{id}/pause", srv.Pause)
+			r.Post("/habits/{id}/resume", srv.Resume)
+			r.Post("/habits/{id}/archive", srv.Archive)
+			r.Post("/habits/{id}/restore", srv.Restore)
+			r.Post("/habits/{id}/checkins", srv.LogCheckIn)
+			r.Post("/habits/{id}/checkins/{checkInID}/delete", srv.DeleteCheckIn)
+			r.Post("/habits/{id}/challenges", srv.StartChallenge)
+			r.Post("/habits/{id}/challenges/abandon", srv.AbandonChallenge)
 
-	r.Get("/", srv.Home)
-	r.Post("/", srv.Delete)
-	r.Post("/perform", srv.PerformHabit)
+			r.Get("/habit", srv.Habit)
+			r.Post("/habit", srv.Create)
 
-	r.Get("/habit", srv.Habit)
-	r.Post("/habit", srv.Create)
+			r.Get("/tokens", srv.Tokens)
+			r.Post("/tokens", srv.CreateToken)
+			r.Post("/tokens/revoke", srv.RevokeToken)
+		})
+	})
 
 	return r
 }
@@ -0,0 +1,713 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+)
+
+func TestHomeListsHabits(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go", "piano")
+	rec := serve(t, habits, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	for _, name := range []string{"Go", "piano"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("home page does not list habit %q", name)
+		}
+	}
+}
+
+func TestHomeWithoutHabits(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), "You are not tracking any habits") {
+		t.Errorf("home page without habits is missing the empty state: %s", rec.Body)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serve(t, habits, http.MethodPost, "/habit", url.Values{"name": {"Go"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habit status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "You successfully created a Go Habit") {
+		t.Errorf("create page is missing the success alert: %s", rec.Body)
+	}
+	if _, err := habits.GetHabit(asTester(), "Go"); err != nil {
+		t.Errorf("created habit is not stored: %v", err)
+	}
+
+	rec = serve(t, habits, http.MethodPost, "/habit", url.Values{"name": {"Go"}})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("creating a duplicate status = %d; want %d", rec.Code, http.StatusConflict)
+	}
+	if !strings.Contains(rec.Body.String(), "Habit already exists") {
+		t.Errorf("create page is missing the duplicate alert: %s", rec.Body)
+	}
+}
+
+func TestCreateWithSchedule(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	tcs := map[string]struct {
+		form url.Values
+		want string
+	}{
+		"gym":   {url.Values{"schedule": {"weekdays"}, "weekday": {"mon", "wed", "fri"}}, "mon,wed,fri"},
+		"run":   {url.Values{"schedule": {"weekly"}, "per_week": {"3"}}, "3/week"},
+		"piano": {url.Values{"schedule": {"daily"}}, "daily"},
+	}
+	for name, tc := range tcs {
+		tc.form.Set("name", name)
+		rec := serve(t, habits, http.MethodPost, "/habit", tc.form)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /habit status = %d; want %d", rec.Code, http.StatusOK)
+		}
+		habit, err := habits.GetHabit(asTester(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if habit.Schedule.String() != tc.want {
+			t.Errorf("%s: got schedule %q; want %q", name, habit.Schedule, tc.want)
+		}
+	}
+}
+
+func TestCreateRejectsInvalidSchedule(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	for _, form := range []url.Values{
+		{"name": {"gym"}, "schedule": {"weekdays"}},
+		{"name": {"gym"}, "schedule": {"weekly"}, "per_week": {"9"}},
+		{"name": {"gym"}, "schedule": {"weekdays"}, "weekday": {"mon", "funday"}},
+	} {
+		rec := serve(t, habits, http.MethodPost, "/habit", form)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST /habit %v status = %d; want %d", form, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if _, err := habits.GetHabit(asTester(), "gym"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("habit with an invalid schedule was stored: %v", err)
+	}
+}
+
+func TestHomeShowsHabitsDueToday(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	rec := serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), "Not due") {
+		t.Errorf("habit created today is not shown as done: %s", rec.Body)
+	}
+	clock.AddDate(0, 0, 1)
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), "Due today") {
+		t.Errorf("habit is not shown as due the next day: %s", rec.Body)
+	}
+}
+
+func TestPerformHabit(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	rec := serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/perform status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "Nice work") {
+		t.Errorf("perform page is missing the massage: %s", rec.Body)
+	}
+	habit, err := habits.GetHabit(asTester(), "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Streak != 1 {
+		t.Errorf("got streak %d; want 1", habit.Streak)
+	}
+}
+
+func TestDetailPageShowsStats(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	if _, err := habits.PerformHabit(asTester(), store.Habit{ID: 1, Name: "Go"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	clock.AddDate(0, 0, 2)
+	rec := serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), `href="/habits/1"`) {
+		t.Errorf("home page is missing the link to the habit: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /habits/1 status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Last 7 days", "1 of 2", "50%", "Last 365 days", `href="/habits/1/edit"`, "<svg", "Sat, Oct 16, 2021: performed"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("detail page is missing %q: %s", want, body)
+		}
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/2", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /habits/2 status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	rec := serve(t, habits, http.MethodGet, "/habits/1", nil)
+	if !strings.Contains(rec.Body.String(), `action="/habits/1/challenges"`) || !strings.Contains(rec.Body.String(), `value="30"`) {
+		t.Errorf("detail page is missing the 30-day challenge form: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/challenges", url.Values{"start": {""}, "days": {"30"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/habits/1" {
+		t.Fatalf("POST /habits/1/challenges status = %d to %q; want %d to /habits/1", rec.Code, rec.Header().Get("Location"), http.StatusSeeOther)
+	}
+	clock.AddDate(0, 0, 1)
+	rec = serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if !strings.Contains(rec.Body.String(), "1 of 30 days of your 30-day challenge") {
+		t.Errorf("perform page is missing the progress of the challenge: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), "day 1 of 30 of challenge") {
+		t.Errorf("home page is missing the progress of the challenge: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/1", nil)
+	body := rec.Body.String()
+	for _, want := range []string{"Day 1 of 30", "1 of 30 days done", `role="progressbar"`, `action="/habits/1/challenges/abandon"`, "running"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("detail page is missing %q: %s", want, body)
+		}
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/challenges", url.Values{"days": {"7"}})
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "already has a challenge running") {
+		t.Errorf("starting a second challenge status = %d; want %d with an alert: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/challenges/abandon", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /habits/1/challenges/abandon status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/1", nil)
+	if !strings.Contains(rec.Body.String(), "abandoned") || !strings.Contains(rec.Body.String(), `action="/habits/1/challenges"`) {
+		t.Errorf("detail page is missing the abandoned challenge and the form for a new one: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/challenges", url.Values{"days": {"many"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("starting a challenge without days status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/2/challenges", url.Values{"days": {"30"}})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("starting a challenge of a missing habit status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestUndoPerform(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	clock.AddDate(0, 0, 1)
+	rec := serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if !strings.Contains(rec.Body.String(), `action="/habits/1/undo"`) {
+		t.Errorf("perform page is missing the undo button: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if strings.Contains(rec.Body.String(), `action="/habits/1/undo"`) {
+		t.Errorf("performing again on the same day offers to undo: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/undo", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /habits/1/undo status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	habit, err := habits.GetHabit(asTester(), "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Streak != 0 || !habit.DueToday {
+		t.Errorf("got streak %d, due %v after undoing; want 0 and due", habit.Streak, habit.DueToday)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/undo", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /habits/1/undo with nothing to undo status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPerformQuantitativeHabit(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	rec := serve(t, habits, http.MethodPost, "/habit", url.Values{"name": {"read"}, "target": {"-20"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /habit with negative target status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habit", url.Values{"name": {"read"}, "target": {"20"}, "unit": {" pages "}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habit status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "0 / 20 pages") || !strings.Contains(body, `name="amount"`) {
+		t.Errorf("home page is missing the progress or amount of the habit: %s", body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/perform", url.Values{"amount": {"many"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /habits/1/perform with invalid amount status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/perform", url.Values{"amount": {"5"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/perform status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "5 of 20 pages today") {
+		t.Errorf("perform page is missing the progress: %s", rec.Body)
+	}
+}
+
+func TestRelapse(t *testing.T) {
+	habits, clock := newMemoryStore(t)
+	rec := serve(t, habits, http.MethodPost, "/habit", url.Values{"name": {"sugar"}, "kind": {"quit"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habit status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	clock.AddDate(0, 0, 3)
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "3 days clean") || !strings.Contains(body, `action="/habits/1/relapse"`) {
+		t.Errorf("home page is missing the days clean or relapse button: %s", body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/relapse", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/relapse status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "after 3 days") {
+		t.Errorf("relapse page is missing the massage: %s", rec.Body)
+	}
+	habit, err := habits.GetHabit(asTester(), "sugar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Streak != 0 {
+		t.Errorf("got streak %d after relapse; want 0", habit.Streak)
+	}
+}
+
+func TestRelapseOnHabitToBuildIsBadRequest(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	rec := serve(t, habits, http.MethodPost, "/habits/1/relapse", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /habits/1/relapse status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMissingHabitIsNotFound(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	for _, path := range []string{
+		"/habits/999/perform",
+		"/habits/999/relapse",
+		"/habits/999/delete",
+		"/habits/x/perform",
+	} {
+		rec := serve(t, habits, http.MethodPost, path, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("POST %s status = %d; want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go", "piano")
+	rec := serve(t, habits, http.MethodPost, "/habits/1/delete", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("POST /habits/1/delete status = %d, Location %q; want a redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+	_, err := habits.GetHabit(asTester(), "Go")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleted habit is still stored: %v", err)
+	}
+	if _, err := habits.GetHabit(asTester(), "piano"); err != nil {
+		t.Errorf("remaining habit is gone: %v", err)
+	}
+}
+
+func TestEditPageShowsTheHabit(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	err := habits.Add(asTester(), store.Habit{Name: "read", Description: "a novel a month", Schedule: store.NewWeekdaySchedule(time.Monday, time.Friday), Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, habits, http.MethodGet, "/habits/1/edit", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /habits/1/edit status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`value="read"`,
+		"a novel a month</textarea>",
+		`value="weekdays" checked`,
+		`value="mon" checked`,
+		`value="tue"/>`,
+		`value="fri" checked`,
+		`value="20"`,
+		`value="pages"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("edit page is missing %s: %s", want, body)
+		}
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/2/edit", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /habits/2/edit status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestEditKeepsIDAndHistory(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go", "piano")
+	for day := 0; day < 3; day++ {
+		clock.AddDate(0, 0, 1)
+		if rec := serve(t, habits, http.MethodPost, "/habits/1/perform", nil); rec.Code != http.StatusOK {
+			t.Fatalf("POST /habits/1/perform status = %d; want %d", rec.Code, http.StatusOK)
+		}
+	}
+	rec := serve(t, habits, http.MethodPost, "/habits/1/edit", url.Values{
+		"name":        {"golang"},
+		"description": {" an hour of exercises "},
+		"schedule":    {"daily"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/edit status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "You successfully updated the golang Habit") {
+		t.Errorf("edit page is missing the success alert: %s", rec.Body)
+	}
+	habit, err := habits.GetHabitByID(asTester(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Name != "golang" || habit.Description != "an hour of exercises" || habit.Streak != 3 {
+		t.Errorf("got habit %q described %q with streak %d; want golang with its description and streak 3", habit.Name, habit.Description, habit.Streak)
+	}
+	history, err := habits.History(asTester(), *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Errorf("got %d check-ins after editing; want 3", len(history))
+	}
+
+	rec = serve(t, habits, http.MethodPost, "/habits/1/edit", url.Values{"name": {"piano"}})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("renaming to a taken name status = %d; want %d", rec.Code, http.StatusConflict)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/edit", url.Values{"name": {"golang"}, "schedule": {"weekdays"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "pick at least one weekday") {
+		t.Errorf("editing without weekdays status = %d; want %d with an alert: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/edit", url.Values{"name": {" "}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("clearing the name status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got, _ := habits.GetHabitByID(asTester(), 1); got.Name != "golang" {
+		t.Errorf("got name %q after failed edits; want golang", got.Name)
+	}
+}
+
+func TestEditHabitToQuit(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	if err := habits.Add(asTester(), store.Habit{Name: "sugar", Kind: store.QuitHabit}); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, habits, http.MethodGet, "/habits/1/edit", nil)
+	if strings.Contains(rec.Body.String(), `name="schedule"`) {
+		t.Errorf("edit page of a habit to quit offers a schedule: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/edit", url.Values{"name": {"candy"}, "target": {"5"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/edit status = %d; want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	habit, err := habits.GetHabitByID(asTester(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.Name != "candy" || habit.Target != 0 || !habit.Quitting() {
+		t.Errorf("got habit %+v; want the renamed habit to quit without a target", habit)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	rec := serve(t, habits, http.MethodPost, "/habits/1/pause", url.Values{"from": {"2021-10-15"}, "until": {"2021-10-20"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/habits/1/edit" {
+		t.Fatalf("POST /habits/1/pause status = %d, Location %q; want a redirect to the edit page", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), "Paused") || strings.Contains(rec.Body.String(), "Due today") {
+		t.Errorf("home page does not show the habit paused: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/1/edit", nil)
+	if !strings.Contains(rec.Body.String(), "Oct 15, 2021 to Oct 20, 2021") {
+		t.Errorf("edit page does not list the pause: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/pause", url.Values{"from": {"2021-10-20"}, "until": {"2021-10-15"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "must not end before it starts") {
+		t.Errorf("backward pause status = %d; want %d with an alert: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/pause", url.Values{"from": {"soon"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("pause without dates status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = serve(t, habits, http.MethodPost, "/habits/1/resume", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /habits/1/resume status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	habit, err := habits.GetHabitByID(asTester(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if habit.PausedToday || len(habit.Pauses) != 0 {
+		t.Errorf("got habit %+v; want it resumed without pauses", habit)
+	}
+}
+
+func TestBackfillCheckIns(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	habits.BackfillDays = 2
+	clock.AddDate(0, 0, 2)
+	rec := serve(t, habits, http.MethodPost, "/habits/1/checkins", url.Values{"date": {"2021-10-16"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/habits/1/edit" {
+		t.Fatalf("POST /habits/1/checkins status = %d, Location %q; want a redirect to the edit page", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = serve(t, habits, http.MethodGet, "/habits/1/edit", nil)
+	if !strings.Contains(rec.Body.String(), "Sat, Oct 16, 2021 00:00") || !strings.Contains(rec.Body.String(), `action="/habits/1/checkins/1/delete"`) {
+		t.Errorf("edit page does not list the logged check-in: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/checkins", url.Values{"date": {"2021-10-16"}})
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "already performed") {
+		t.Errorf("logging a day twice status = %d; want %d with an alert: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/checkins", url.Values{"date": {"2021-10-14"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "up to 2 days back") {
+		t.Errorf("logging a day out of the window status = %d; want %d with an alert: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+
+	rec = serve(t, habits, http.MethodPost, "/habits/1/checkins/1/delete", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /habits/1/checkins/1/delete status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	history, err := habits.History(asTester(), store.Habit{ID: 1})
+	if err != nil || len(history) != 0 {
+		t.Errorf("got history %+v, %v; want the check-in removed", history, err)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/checkins/1/delete", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("removing a check-in twice status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go", "piano")
+	rec := serve(t, habits, http.MethodPost, "/habits/1/archive", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("POST /habits/1/archive status = %d, Location %q; want a redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	body := rec.Body.String()
+	if strings.Contains(body, `action="/habits/1/perform"`) || !strings.Contains(body, `action="/habits/1/restore"`) {
+		t.Errorf("home page does not move the archived habit out of the list: %s", body)
+	}
+	if !strings.Contains(body, `action="/habits/2/perform"`) {
+		t.Errorf("home page lost the habit in use: %s", body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("performing an archived habit status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = serve(t, habits, http.MethodPost, "/habits/1/restore", nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /habits/1/restore status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	rec = serve(t, habits, http.MethodGet, "/", nil)
+	if !strings.Contains(rec.Body.String(), `action="/habits/1/perform"`) {
+		t.Errorf("home page does not list the restored habit: %s", rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/999/archive", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("POST /habits/999/archive status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPerformAfterRenameKeepsTheHabit(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	habit, err := habits.GetHabit(asTester(), "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	habit.Name = "golang"
+	if err := habits.UpdateHabit(asTester(), *habit); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, habits, http.MethodPost, "/habits/1/perform", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /habits/1/perform after renaming status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), "golang") {
+		t.Errorf("perform page is missing the new name: %s", rec.Body)
+	}
+}
+
+func TestStoreFailureIsInternalServerError(t *testing.T) {
+	rec := serve(t, failingStore{}, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET / status = %d; want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+// serve sends the request, with an optional form body, through the router,
+// signed in as the tester
+func serve(t *testing.T, habits store.Store, method, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveSignedIn(t, habits, newFormRequest(method, target, form))
+}
+
+// serveSignedIn sends the request through the router with the session
+// cookie of the tester
+func serveSignedIn(t *testing.T, habits store.Store, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	session, err := habits.CreateSession(context.Background(), testerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: session.Token})
+	rec := httptest.NewRecorder()
+	Service(habits).ServeHTTP(rec, req)
+	return rec
+}
+
+// testCSRFToken is the CSRF token of the browser in tests
+const testCSRFToken = "test-csrf-token"
+
+// newFormRequest returns a request with the form, if any, as its body.
+// Posts carry the CSRF token of the browser like the forms of its pages do.
+func newFormRequest(method, target string, form url.Values) *http.Request {
+	if method == http.MethodPost {
+		posted := url.Values{csrfField: {testCSRFToken}}
+		for key, values := range form {
+			posted[key] = values
+		}
+		form = posted
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRFToken})
+	return req
+}
+
+// The tester is the user newMemoryStore signs up
+const (
+	testerID       = 1
+	testerEmail    = "tester@example.com"
+	testerPassword = "correct horse"
+)
+
+// asTester returns a context acting on behalf of the tester
+func asTester() context.Context {
+	return store.WithUser(context.Background(), &store.User{ID: testerID})
+}
+
+// newMemoryStore returns a memory store with the tester signed up and
+// holding the named habits, together with the fake clock it tells the time by
+func newMemoryStore(t *testing.T, names ...string) (*store.MemoryStore, *store.FixedClock) {
+	t.Helper()
+	clock := store.NewFixedClock(time.Date(2021, 10, 15, 17, 8, 0, 0, time.UTC))
+	habits := store.NewMemoryStore()
+	habits.Output = io.Discard
+	habits.Clock = clock
+	_, err := habits.AddUser(context.Background(), testerEmail, testerPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := habits.Add(asTester(), store.Habit{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return habits, clock
+}
+
+// failingStore is a Store whose every method fails
+type failingStore struct{}
+
+var errFailing = errors.New("store is failing")
+
+func (failingStore) Add(context.Context, store.Habit) error { return errFailing }
+func (failingStore) AllHabits(context.Context) ([]store.Habit, error) {
+	return nil, errFailing
+}
+func (failingStore) PerformHabit(context.Context, store.Habit, float64) (string, error) {
+	return "", errFailing
+}
+func (failingStore) Relapse(context.Context, store.Habit) (string, error) {
+	return "", errFailing
+}
+func (failingStore) GetHabit(context.Context, string) (*store.Habit, error) {
+	return nil, errFailing
+}
+func (failingStore) GetHabitByID(context.Context, int) (*store.Habit, error) {
+	return nil, errFailing
+}
+func (failingStore) UpdateHabit(context.Context, store.Habit) error { return errFailing }
+func (failingStore) DeleteHabit(context.Context, int) error         { return errFailing }
+func (failingStore) PauseHabit(context.Context, int, time.Time, time.Time) error {
+	return errFailing
+}
+func (failingStore) ResumeHabit(context.Context, int) error        { return errFailing }
+func (failingStore) ArchiveHabit(context.Context, int, bool) error { return errFailing }
+func (failingStore) LogCheckIn(context.Context, int, time.Time, float64) error {
+	return errFailing
+}
+func (failingStore) DeleteCheckIn(context.Context, int, int) error             { return errFailing }
+func (failingStore) UndoPerform(context.Context, int) error                    { return errFailing }
+func (failingStore) Stats(context.Context, int) (*store.Stats, error)          { return nil, errFailing }
+func (failingStore) StartChallenge(context.Context, int, time.Time, int) error { return errFailing }
+func (failingStore) AbandonChallenge(context.Context, int) error               { return errFailing }
+func (failingStore) Challenges(context.Context, int) ([]store.Challenge, error) {
+	return nil, errFailing
+}
+func (failingStore) History(context.Context, store.Habit) ([]store.CheckIn, error) {
+	return nil, errFailing
+}
+func (failingStore) AddUser(context.Context, string, string) (*store.User, error) {
+	return nil, errFailing
+}
+func (failingStore) Authenticate(context.Context, string, string) (*store.User, error) {
+	return nil, errFailing
+}
+func (failingStore) GetUser(context.Context, int) (*store.User, error) {
+	return nil, errFailing
+}
+
+// The sessions of failingStore work, so that requests get past signing in
+// and fail on the habits instead
+func (failingStore) CreateSession(context.Context, int) (*store.Session, error) {
+	return &store.Session{Token: "tester", UserID: testerID}, nil
+}
+func (failingStore) SessionUser(context.Context, string) (*store.User, error) {
+	return &store.User{ID: testerID, Email: testerEmail}, nil
+}
+func (failingStore) DeleteSession(context.Context, string) error   { return nil }
+func (failingStore) DeleteUserSessions(context.Context, int) error { return nil }
+func (failingStore) CreateToken(context.Context, int, string) (*store.APIToken, error) {
+	return nil, errFailing
+}
+func (failingStore) Tokens(context.Context, int) ([]store.APIToken, error) {
+	return nil, errFailing
+}
+func (failingStore) RevokeToken(context.Context, int, int) error { return errFailing }
+func (failingStore) TokenUser(context.Context, string) (*store.User, error) {
+	return nil, errFailing
+}
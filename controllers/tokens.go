@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/miloszizic/habits/store"
+	"github.com/miloszizic/habits/templates"
+	"github.com/miloszizic/habits/views"
+)
+
+// tokensPage is what the API tokens page shows: the tokens of the user and
+// the one just created, whose secret is shown this once
+type tokensPage struct {
+	Tokens  []store.APIToken
+	Created *store.APIToken
+}
+
+// Tokens handler lists the API tokens of the user
+func (s Server) Tokens(w http.ResponseWriter, r *http.Request) {
+	s.renderTokens(w, r, newData(r), nil)
+}
+
+// CreateToken handler creates an API token and shows its secret
+func (s Server) CreateToken(w http.ResponseWriter, r *http.Request) {
+	data := newData(r)
+	token, err := s.APITokens.CreateToken(r.Context(), data.User.ID, r.FormValue("name"))
+	if errors.Is(err, store.ErrInvalid) {
+		data.Alert = &views.Alert{Color: views.AlertLvlError, Message: err.Error()}
+		s.renderTokens(w, r, data, nil)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.renderTokens(w, r, data, token)
+}
+
+// RevokeToken handler revokes an API token of the user
+func (s Server) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	data := newData(r)
+	id, err := strconv.Atoi(r.FormValue("revoke"))
+	if err != nil {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	err = s.APITokens.RevokeToken(r.Context(), data.User.ID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data.Alert = &views.Alert{Color: views.AlertLvlSuccess, Message: "Token revoked, it no longer works"}
+	s.renderTokens(w, r, data, nil)
+}
+
+// renderTokens shows the API tokens page with the tokens of the user
+func (s Server) renderTokens(w http.ResponseWriter, r *http.Request, data views.Data, created *store.APIToken) {
+	tokens, err := s.APITokens.Tokens(r.Context(), data.User.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	data.Yield = tokensPage{Tokens: tokens, Created: created}
+	if data.Alert != nil && data.Alert.Color == views.AlertLvlError {
+		writeStatus(w, http.StatusBadRequest)
+	}
+	tpl := views.Must(views.ParseFS(templates.Files, "tokens.gohtml", "*.layout.gohtml"))
+	tpl.Execute(w, data)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+)
+
+func TestAPITokensSignScriptsIn(t *testing.T) {
+	habits, clock := newMemoryStore(t, "Go")
+	rec := serve(t, habits, http.MethodGet, "/tokens", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "no API tokens yet") {
+		t.Fatalf("GET /tokens status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodPost, "/tokens", url.Values{"name": {"cron job"}})
+	secret := regexp.MustCompile(`habits_[A-Za-z0-9_-]+`).FindString(rec.Body.String())
+	if rec.Code != http.StatusOK || secret == "" {
+		t.Fatalf("POST /tokens status = %d, want the page showing the new token: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "cron job") || !strings.Contains(rec.Body.String(), "never") {
+		t.Errorf("tokens page is missing the unused cron job token: %s", rec.Body)
+	}
+
+	clock.Add(time.Hour)
+	rec = listWithAuthorization(habits, "Bearer "+secret)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"Go"`) {
+		t.Errorf("GET /api/v1/habits with the token status = %d, want the habits of the tester: %s", rec.Code, rec.Body)
+	}
+	rec = serve(t, habits, http.MethodGet, "/tokens", nil)
+	if strings.Contains(rec.Body.String(), secret) {
+		t.Error("tokens page shows the secret of the token again")
+	}
+	if !strings.Contains(rec.Body.String(), clock.Now().Format("Jan 02, 2006 15:04 MST")) {
+		t.Errorf("tokens page is missing when the token was last used: %s", rec.Body)
+	}
+
+	tokens, err := habits.Tokens(context.Background(), testerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(t, habits, http.MethodPost, "/tokens/revoke", url.Values{"revoke": {"1"}})
+	if rec.Code != http.StatusOK || len(tokens) != 1 || !strings.Contains(rec.Body.String(), "no API tokens yet") {
+		t.Errorf("POST /tokens/revoke status = %d, want the page without tokens: %s", rec.Code, rec.Body)
+	}
+	rec = listWithAuthorization(habits, "Bearer "+secret)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/v1/habits with a revoked token status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPITokensStayWithTheirUser(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	ana, err := habits.AddUser(context.Background(), "ana@example.com", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := habits.CreateToken(context.Background(), ana.ID, "ana's")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, habits, http.MethodGet, "/tokens", nil)
+	if strings.Contains(rec.Body.String(), "ana's") {
+		t.Errorf("tester sees the tokens of other users: %s", rec.Body)
+	}
+	for _, id := range []string{"1", "x"} {
+		rec = serve(t, habits, http.MethodPost, "/tokens/revoke", url.Values{"revoke": {id}})
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("revoking token %q of another user status = %d; want %d", id, rec.Code, http.StatusNotFound)
+		}
+	}
+	if _, err := habits.TokenUser(context.Background(), token.Token); err != nil {
+		t.Errorf("token of Ana stopped working: %v", err)
+	}
+	rec = serve(t, habits, http.MethodPost, "/tokens", url.Values{"name": {" "}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "token needs a name") {
+		t.Errorf("creating a token without a name status = %d; want %d with an alert", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIRejectsTokensThatDontWork(t *testing.T) {
+	router := loadSpec(t)
+	habits, _ := newMemoryStore(t)
+	for _, header := range []string{"", "Bearer habits_forged", "Basic dGVzdGVyOnBhc3N3b3Jk", "Bearer"} {
+		rec := listWithAuthorization(habits, header)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: status = %d; want %d asking for a token", header, rec.Code, http.StatusUnauthorized)
+		}
+		validateExchange(t, router, "GET /api/v1/habits", "", rec)
+	}
+}
+
+// listWithAuthorization lists habits through the API with the Authorization
+// header
+func listWithAuthorization(habits store.Store, header string) *httptest.ResponseRecorder {
+	req := newJSONRequest(http.MethodGet, "/api/v1/habits", "")
+	req.Header.Set("Authorization", header)
+	rec := httptest.NewRecorder()
+	Service(habits).ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+	"github.com/miloszizic/habits/templates"
+	"github.com/miloszizic/habits/views"
+)
+
+// sessionCookie is the name of the cookie holding the session token
+const sessionCookie = "session"
+
+// currentUser returns the user signed in with the session cookie of the
+// request, or nil when there is none or the session is over
+func currentUser(r *http.Request, sessions store.SessionStore) (*store.User, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := sessions.SessionUser(r.Context(), cookie.Value)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// Authenticate middleware makes the requests of signed-in users act on their
+// behalf
+func (s Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := currentUser(r, s.Sessions)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		if user != nil {
+			r = r.WithContext(store.WithUser(r.Context(), user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireUser middleware sends visitors who are not signed in to the login page
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if store.UserFrom(r.Context()) == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SignupForm handler shows the signup page
+func (s Server) SignupForm(w http.ResponseWriter, r *http.Request) {
+	tpl := views.Must(views.ParseFS(templates.Files, "signup.gohtml", "*.layout.gohtml"))
+	tpl.Execute(w, newData(r))
+}
+
+// Signup handler creates an account and signs the new user in
+func (s Server) Signup(w http.ResponseWriter, r *http.Request) {
+	user, err := s.Users.AddUser(r.Context(), r.FormValue("email"), r.FormValue("password"))
+	if err != nil {
+		data := newData(r)
+		data.Yield = r.FormValue("email")
+		tpl := views.Must(views.ParseFS(templates.Files, "signup.gohtml", "*.layout.gohtml"))
+		switch {
+		case errors.Is(err, store.ErrEmailTaken):
+			data.Alert = &views.Alert{Color: views.AlertLvlError, Message: "That email is already signed up, log in instead"}
+			writeStatus(w, http.StatusConflict)
+		case errors.Is(err, store.ErrInvalid):
+			data.Alert = &views.Alert{Color: views.AlertLvlError, Message: err.Error()}
+			writeStatus(w, http.StatusBadRequest)
+		default:
+			storeError(w, err)
+			return
+		}
+		tpl.Execute(w, data)
+		return
+	}
+	s.signIn(w, r, user)
+}
+
+// LoginForm handler shows the login page
+func (s Server) LoginForm(w http.ResponseWriter, r *http.Request) {
+	tpl := views.Must(views.ParseFS(templates.Files, "login.gohtml", "*.layout.gohtml"))
+	tpl.Execute(w, newData(r))
+}
+
+// Login handler checks the email and password and signs the user in
+func (s Server) Login(w http.ResponseWriter, r *http.Request) {
+	user, err := s.Users.Authenticate(r.Context(), r.FormValue("email"), r.FormValue("password"))
+	if errors.Is(err, store.ErrWrongPassword) {
+		data := newData(r)
+		data.Yield = r.FormValue("email")
+		data.Alert = &views.Alert{Color: views.AlertLvlError, Message: "Email or password is wrong"}
+		tpl := views.Must(views.ParseFS(templates.Files, "login.gohtml", "*.layout.gohtml"))
+		writeStatus(w, http.StatusUnauthorized)
+		tpl.Execute(w, data)
+		return
+	}
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	s.signIn(w, r, user)
+}
+
+// Logout handler ends the session and returns to the login page
+func (s Server) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		err := s.Sessions.DeleteSession(r.Context(), cookie.Value)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	signOut(w, r)
+}
+
+// LogoutEverywhere handler ends every session of the user, on all their
+// devices, and returns to the login page
+func (s Server) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	err := s.Sessions.DeleteUserSessions(r.Context(), store.UserFrom(r.Context()).ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	signOut(w, r)
+}
+
+// signIn starts a new session for the user, ending the one the request came
+// with, and sends them to their habits
+func (s Server) signIn(w http.ResponseWriter, r *http.Request, user *store.User) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		err := s.Sessions.DeleteSession(r.Context(), cookie.Value)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	session, err := s.Sessions.CreateSession(r.Context(), user.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	http.SetCookie(w, newSessionCookie(r, session.Token, session.ExpiresAt))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// signOut removes the session cookie and sends the user to the login page
+func signOut(w http.ResponseWriter, r *http.Request) {
+	cookie := newSessionCookie(r, "", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// newSessionCookie returns the cookie holding the session token until it
+// expires. Scripts can't read it, other sites don't get it with their form
+// posts and it only travels over HTTPS when the request came that way.
+func newSessionCookie(r *http.Request, token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secureRequest(r),
+	}
+}
+
+// secureRequest reports whether the request came over HTTPS, directly or
+// through a proxy
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// newData returns the view data of a page for the user of the request
+func newData(r *http.Request) views.Data {
+	return views.Data{User: store.UserFrom(r.Context()), CSRFToken: csrfToken(r)}
+}
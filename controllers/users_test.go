@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+)
+
+func TestSignupSignsIn(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	service := Service(habits)
+	rec := send(service, http.MethodGet, "/signup", nil, nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "no value") {
+		t.Fatalf("GET /signup status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = send(service, http.MethodPost, "/signup", url.Values{"email": {"ana@example.com"}, "password": {"battery staple"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("POST /signup status = %d, Location %q; want a redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+	cookie := sessionFrom(t, rec)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("got session cookie %+v; want it HttpOnly and SameSite=Lax on /", cookie)
+	}
+	rec = send(service, http.MethodGet, "/", nil, cookie)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ana@example.com") {
+		t.Errorf("GET / after signing up status = %d, want the home page of ana: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSignupRejectsBadAccounts(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	tcs := map[string]struct {
+		form   url.Values
+		status int
+		alert  string
+	}{
+		"taken email":    {url.Values{"email": {testerEmail}, "password": {"battery staple"}}, http.StatusConflict, "already signed up"},
+		"invalid email":  {url.Values{"email": {"ana"}, "password": {"battery staple"}}, http.StatusBadRequest, "not a valid email"},
+		"short password": {url.Values{"email": {"ana@example.com"}, "password": {"staple"}}, http.StatusBadRequest, "at least 8 characters"},
+	}
+	for name, tc := range tcs {
+		rec := send(Service(habits), http.MethodPost, "/signup", tc.form, nil)
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d; want %d", name, rec.Code, tc.status)
+		}
+		if !strings.Contains(rec.Body.String(), tc.alert) {
+			t.Errorf("%s: signup page is missing the alert %q", name, tc.alert)
+		}
+		if len(rec.Result().Cookies()) != 0 {
+			t.Errorf("%s: got a session cookie", name)
+		}
+	}
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	service := Service(habits)
+	rec := send(service, http.MethodPost, "/login", url.Values{"email": {testerEmail}, "password": {"wrong horse"}}, nil)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Email or password is wrong") {
+		t.Errorf("POST /login with a wrong password status = %d; want %d with an alert", rec.Code, http.StatusUnauthorized)
+	}
+	rec = send(service, http.MethodPost, "/login", url.Values{"email": {"Tester@Example.com"}, "password": {testerPassword}}, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST /login status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	cookie := sessionFrom(t, rec)
+	rec = send(service, http.MethodGet, "/", nil, cookie)
+	if !strings.Contains(rec.Body.String(), "Go") || !strings.Contains(rec.Body.String(), "Logout") {
+		t.Errorf("home page of the tester is missing their habit or the logout button: %s", rec.Body)
+	}
+	rec = send(service, http.MethodPost, "/logout", nil, cookie)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("POST /logout status = %d, Location %q; want a redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = send(service, http.MethodGet, "/", nil, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("GET / with the session of a logged out user status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestSessionCookieLastsAsLongAsTheSession(t *testing.T) {
+	habits, clock := newMemoryStore(t)
+	req := newFormRequest(http.MethodPost, "/login", url.Values{"email": {testerEmail}, "password": {testerPassword}})
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	Service(habits).ServeHTTP(rec, req)
+	cookie := sessionFrom(t, rec)
+	if want := clock.Now().Add(store.DefaultLifetime); !cookie.Expires.Equal(want) {
+		t.Errorf("session cookie expires at %v; want %v", cookie.Expires, want)
+	}
+	if !cookie.Secure {
+		t.Error("session cookie of a request forwarded over HTTPS is not Secure")
+	}
+}
+
+func TestSessionsExpire(t *testing.T) {
+	habits, clock := newMemoryStore(t)
+	habits.Sessions = store.SessionPolicy{IdleTimeout: time.Hour, Lifetime: 3 * time.Hour}
+	service := Service(habits)
+	rec := send(service, http.MethodPost, "/login", url.Values{"email": {testerEmail}, "password": {testerPassword}}, nil)
+	cookie := sessionFrom(t, rec)
+	for i := 0; i < 5; i++ {
+		clock.Add(50 * time.Minute)
+		rec = send(service, http.MethodGet, "/", nil, cookie)
+		if i < 3 && rec.Code != http.StatusOK {
+			t.Fatalf("GET / %v after signing in status = %d; want %d", time.Duration(i+1)*50*time.Minute, rec.Code, http.StatusOK)
+		}
+	}
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("GET / after the session lifetime status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+	rec = send(service, http.MethodPost, "/login", url.Values{"email": {testerEmail}, "password": {testerPassword}}, nil)
+	cookie = sessionFrom(t, rec)
+	clock.Add(61 * time.Minute)
+	rec = send(service, http.MethodGet, "/", nil, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("GET / after an idle hour status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	habits, _ := newMemoryStore(t)
+	service := Service(habits)
+	var cookies []*http.Cookie
+	for i := 0; i < 2; i++ {
+		rec := send(service, http.MethodPost, "/login", url.Values{"email": {testerEmail}, "password": {testerPassword}}, nil)
+		cookies = append(cookies, sessionFrom(t, rec))
+	}
+	rec := send(service, http.MethodGet, "/", nil, cookies[0])
+	if !strings.Contains(rec.Body.String(), "Log out everywhere") {
+		t.Errorf("home page is missing the button to log out everywhere: %s", rec.Body)
+	}
+	rec = send(service, http.MethodPost, "/logout/all", nil, cookies[0])
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("POST /logout/all status = %d, Location %q; want a redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	for i, cookie := range cookies {
+		rec = send(service, http.MethodGet, "/", nil, cookie)
+		if rec.Code != http.StatusSeeOther {
+			t.Errorf("GET / with session %d after logging out everywhere status = %d; want %d", i, rec.Code, http.StatusSeeOther)
+		}
+	}
+}
+
+func TestPagesRequireSignIn(t *testing.T) {
+	habits, _ := newMemoryStore(t, "Go")
+	for _, page := range []struct{ method, target string }{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/habit"},
+		{http.MethodPost, "/habit"},
+		{http.MethodPost, "/habits/1/perform"},
+		{http.MethodPost, "/habits/1/delete"},
+	} {
+		rec := send(Service(habits), page.method, page.target, nil, nil)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+			t.Errorf("%s %s without signing in status = %d; want a redirect to /login", page.method, page.target, rec.Code)
+		}
+	}
+	if _, err := habits.GetHabit(asTester(), "Go"); err != nil {
+		t.Errorf("habit is gone after requests without signing in: %v", err)
+	}
+	rec := send(Service(habits), http.MethodGet, "/", nil, &http.Cookie{Name: sessionCookie, Value: "forged"})
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("GET / with an unknown session status = %d; want %d", rec.Code, http.StatusSeeOther)
+	}
+}
+
+func TestUsersOnlySeeTheirHabits(t *testing.T) {
+	habits, _ := newMemoryStore(t, "piano")
+	ana, err := habits.AddUser(context.Background(), "ana@example.com", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := habits.Add(store.WithUser(context.Background(), ana), store.Habit{Name: "guitar"}); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, habits, http.MethodGet, "/", nil)
+	if strings.Contains(rec.Body.String(), "guitar") || !strings.Contains(rec.Body.String(), "piano") {
+		t.Errorf("tester sees habits of other users: %s", rec.Body)
+	}
+	guitar, err := habits.GetHabit(store.WithUser(context.Background(), ana), "guitar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(t, habits, http.MethodPost, "/habits/"+strconv.Itoa(guitar.ID)+"/perform", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("performing the habit of another user status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	rec = httptest.NewRecorder()
+	Service(habits).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/habits", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("API without a session status = %d; want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+// send serves the request with the form, if any, and the cookie, if any
+func send(service http.Handler, method, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := newFormRequest(method, target, form)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	service.ServeHTTP(rec, req)
+	return rec
+}
+
+// sessionFrom returns the session cookie set by the response
+func sessionFrom(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	t.Fatal("response does not set a session cookie")
+	return nil
+}
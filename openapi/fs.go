@@ -0,0 +1,8 @@
+package openapi
+
+import (
+	_ "embed"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
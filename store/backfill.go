@@ -0,0 +1,64 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// UndoWindow is how long after a check-in was recorded performing the habit
+// can be undone
+const UndoWindow = 10 * time.Minute
+
+// undoable reports whether a check-in recorded at the given time can still
+// be undone at now
+func undoable(performedAt, now time.Time) bool {
+	return now.Sub(performedAt) <= UndoWindow
+}
+
+// DefaultBackfillDays is how many days back check-ins can be logged or
+// removed when a store does not set its own window
+const DefaultBackfillDays = 7
+
+// backfillWindow returns the days back check-ins can be logged or removed,
+// given the days a store allows, or zero for DefaultBackfillDays
+func backfillWindow(days int) int {
+	if days <= 0 {
+		return DefaultBackfillDays
+	}
+	return days
+}
+
+// checkBackfill checks that the check-ins of the habit on the calendar day
+// can be logged or removed as of today, going back at most window days
+func checkBackfill(h Habit, d, today day, window int) error {
+	switch {
+	case h.Quitting():
+		return fmt.Errorf("relapses of habit to quit '%s' can't be changed: %w", h.Name, ErrInvalid)
+	case h.Archived():
+		return fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	case d > today:
+		return fmt.Errorf("'%s' can't be performed on a day still to come: %w", h.Name, ErrInvalid)
+	case d < today-day(window):
+		return fmt.Errorf("check-ins of '%s' can only be changed up to %d days back: %w", h.Name, window, ErrInvalid)
+	}
+	return nil
+}
+
+// backfilledAt returns the time a check-in logged for the calendar day is
+// recorded at: now for today, and the start of the day for days gone by
+func (c Calendar) backfilledAt(d day, now time.Time) time.Time {
+	if d == c.dayOf(now) {
+		return now
+	}
+	return c.start(d)
+}
+
+// performedOn reports whether any of the check-ins falls on the calendar day
+func (c Calendar) performedOn(checkIns []CheckIn, d day) bool {
+	for _, checkIn := range checkIns {
+		if c.dayOf(checkIn.PerformedAt) == d {
+			return true
+		}
+	}
+	return false
+}
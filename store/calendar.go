@@ -0,0 +1,84 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateLayout is the layout calendar days are written in, like 2021-10-14,
+// wherever dates are read or shown: the API, the command line and the forms
+// of the site
+const DateLayout = "2006-01-02"
+
+// Calendar decides which calendar day a moment falls on. Days are counted in
+// Location, UTC when nil, and start DayStart after midnight, so that with a
+// DayStart of four hours a check-in at 01:30 still counts for the day before.
+type Calendar struct {
+	Location *time.Location
+	DayStart time.Duration
+}
+
+// NewCalendar returns the calendar of the IANA timezone, like
+// "Europe/Belgrade", whose days start at dayStart, given as "04:00". Empty
+// values stand for UTC and midnight.
+func NewCalendar(timezone, dayStart string) (Calendar, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("unknown timezone %q: %w", timezone, ErrInvalid)
+	}
+	c := Calendar{Location: location}
+	if dayStart == "" {
+		return c, nil
+	}
+	start, err := time.Parse("15:04", dayStart)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("day start %q must be a time like 04:00: %w", dayStart, ErrInvalid)
+	}
+	c.DayStart = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	return c, nil
+}
+
+// location returns the timezone of the calendar
+func (c Calendar) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// day is a calendar day, counted from the Unix epoch
+type day int
+
+// dayOf returns the calendar day the time falls on
+func (c Calendar) dayOf(t time.Time) day {
+	y, m, d := t.In(c.location()).Add(-c.DayStart).Date()
+	return day(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+}
+
+// start returns the moment the calendar day starts
+func (c Calendar) start(d day) time.Time {
+	y, m, dd := time.Unix(int64(d)*24*60*60, 0).UTC().Date()
+	return time.Date(y, m, dd, 0, 0, 0, 0, c.location()).Add(c.DayStart)
+}
+
+// Date writes the calendar day the time falls on, moved by the given number
+// of days, in DateLayout: -1 gives the day before
+func (c Calendar) Date(t time.Time, days int) string {
+	return c.start(c.dayOf(t) + day(days)).Format(DateLayout)
+}
+
+// daysBetween returns the number of calendar days from one time to another
+func (c Calendar) daysBetween(from, to time.Time) int {
+	return int(c.dayOf(to) - c.dayOf(from))
+}
+
+// Weekday returns the day of the week of the calendar day
+func (d day) Weekday() time.Weekday {
+	// The Unix epoch was a Thursday
+	return time.Weekday((int(d) + int(time.Thursday)) % 7)
+}
+
+// weekStart returns the Monday starting the week of the calendar day
+func (d day) weekStart() day {
+	return d - day((d.Weekday()+6)%7)
+}
@@ -0,0 +1,65 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+)
+
+func TestNewCalendar(t *testing.T) {
+	calendar, err := store.NewCalendar("Europe/Belgrade", "04:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.Location.String() != "Europe/Belgrade" {
+		t.Errorf("got location %s; want Europe/Belgrade", calendar.Location)
+	}
+	if want := 4*time.Hour + 30*time.Minute; calendar.DayStart != want {
+		t.Errorf("got day start %v; want %v", calendar.DayStart, want)
+	}
+	calendar, err = store.NewCalendar("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.Location != time.UTC || calendar.DayStart != 0 {
+		t.Errorf("got %v starting at %v; want UTC starting at midnight", calendar.Location, calendar.DayStart)
+	}
+}
+
+func TestNewCalendarRejectsInvalidSettings(t *testing.T) {
+	tcs := map[string][2]string{
+		"unknown timezone":  {"Europe/Atlantis", ""},
+		"day start":         {"UTC", "4 o'clock"},
+		"day start too big": {"UTC", "25:00"},
+	}
+	for name, tc := range tcs {
+		_, err := store.NewCalendar(tc[0], tc[1])
+		if !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("%s: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestCalendarDate(t *testing.T) {
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar := store.Calendar{Location: belgrade, DayStart: 4 * time.Hour}
+	// 01:30 in Belgrade still counts for the day before
+	now := time.Date(2021, 10, 15, 23, 30, 0, 0, time.UTC)
+	if got := calendar.Date(now, 0); got != "2021-10-15" {
+		t.Errorf("Date(now, 0) = %s; want 2021-10-15", got)
+	}
+	if got := calendar.Date(now, -1); got != "2021-10-14" {
+		t.Errorf("Date(now, -1) = %s; want 2021-10-14", got)
+	}
+	if got := (store.Calendar{}).Date(now, 0); got != "2021-10-15" {
+		t.Errorf("Date(now, 0) in UTC = %s; want 2021-10-15", got)
+	}
+	if got := (store.Calendar{Location: belgrade}).Date(now, 0); got != "2021-10-16" {
+		t.Errorf("Date(now, 0) in Belgrade = %s; want 2021-10-16", got)
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultChallengeDays is how long a challenge runs unless told otherwise
+const DefaultChallengeDays = 30
+
+// maxChallengeDays is the longest challenge that can be taken on
+const maxChallengeDays = 365
+
+// Outcome tells how a challenge went
+type Outcome string
+
+const (
+	// ChallengeRunning is a challenge with days still to go
+	ChallengeRunning Outcome = "running"
+	// ChallengeSucceeded is a challenge whose every day was kept up
+	ChallengeSucceeded Outcome = "succeeded"
+	// ChallengeFailed is a challenge with a missed day, or for habits to
+	// quit a relapse
+	ChallengeFailed Outcome = "failed"
+	// ChallengeAbandoned is a challenge given up while it was running
+	ChallengeAbandoned Outcome = "abandoned"
+)
+
+// Challenge is an attempt to keep a habit up for Days calendar days from the
+// date of Start: performing it on every day it is due, or for habits to quit
+// staying away from it. Paused days are not due. AbandonedOn is the date the
+// challenge was given up on, if it was. Outcome, Day, the day of the
+// challenge today, and Done of Due, its progress, are not stored but worked
+// out by the store from the history of the habit whenever it is read.
+type Challenge struct {
+	ID          int
+	HabitID     int
+	Start       time.Time
+	Days        int
+	AbandonedOn time.Time
+	Outcome     Outcome
+	Day         int
+	Due         int
+	Done        int
+}
+
+// Running reports whether the challenge still has days to go
+func (c Challenge) Running() bool {
+	return c.Outcome == ChallengeRunning
+}
+
+// Abandoned reports whether the challenge was given up on
+func (c Challenge) Abandoned() bool {
+	return !c.AbandonedOn.IsZero()
+}
+
+// End returns the date of the last day of the challenge
+func (c Challenge) End() time.Time {
+	return (dateOf(c.Start) + day(c.Days) - 1).date()
+}
+
+// Percent returns the share of the due days done as a whole percentage
+func (c Challenge) Percent() int {
+	return Completion{Due: c.Due, Done: c.Done}.Percent()
+}
+
+// newChallenge returns the challenge of the habit over days from the date of
+// start, checking that it makes sense as of the calendar day of now and can
+// go back at most window days. The latest challenge of the habit, if any, must be over. A
+// zero start is today, or tomorrow for habits added today that PerformHabit
+// can't record a check-in of until then, and no challenge starts later than
+// tomorrow, so that none keeps new ones waiting before it has even begun.
+func (c Calendar) newChallenge(h Habit, start time.Time, days int, now time.Time, window int, latest *Challenge) (Challenge, error) {
+	today := c.dayOf(now)
+	if days == 0 {
+		days = DefaultChallengeDays
+	}
+	d := dateOf(start)
+	if start.IsZero() {
+		d = today
+		if !h.Quitting() && !h.Quantitative() && c.dayOf(h.LastPerformed) == today && h.Streak == 0 {
+			d++
+		}
+	}
+	switch {
+	case h.Archived():
+		return Challenge{}, fmt.Errorf("archived habit '%s' can't take on a challenge: %w", h.Name, ErrInvalid)
+	case h.Schedule.Weekly():
+		return Challenge{}, fmt.Errorf("challenges of '%s' need it due on set days rather than a weekly target: %w", h.Name, ErrInvalid)
+	case days < 1 || days > maxChallengeDays:
+		return Challenge{}, fmt.Errorf("challenge of '%s' must last from 1 to %d days: %w", h.Name, maxChallengeDays, ErrInvalid)
+	case d < today-day(window):
+		return Challenge{}, fmt.Errorf("challenge of '%s' can start at most %d days back: %w", h.Name, window, ErrInvalid)
+	case d > today+1:
+		return Challenge{}, fmt.Errorf("challenge of '%s' can start tomorrow at the latest: %w", h.Name, ErrInvalid)
+	case latest != nil && latest.Running():
+		return Challenge{}, fmt.Errorf("'%s' already has a challenge running: %w", h.Name, ErrExists)
+	}
+	return Challenge{HabitID: h.ID, Start: d.date(), Days: days}, nil
+}
+
+// judge works out the outcome and progress of the challenge of the habit
+// from its check-in history, which must go back to the start of the
+// challenge, as of the calendar day of now
+func (c Calendar) judge(ch Challenge, h Habit, history []CheckIn, now time.Time) Challenge {
+	performed := c.performedDays(history, h)
+	today := c.dayOf(now)
+	if ch.Abandoned() && dateOf(ch.AbandonedOn) < today {
+		today = dateOf(ch.AbandonedOn)
+	}
+	start := dateOf(ch.Start)
+	end := start + day(ch.Days) - 1
+	ch.Day = int(today-start) + 1
+	if ch.Day < 0 {
+		ch.Day = 0
+	}
+	if ch.Day > ch.Days {
+		ch.Day = ch.Days
+	}
+	ch.Due, ch.Done = 0, 0
+	failed, pending := false, false
+	for d := start; d <= end; d++ {
+		switch {
+		case h.Quitting() && performed[d] && d <= today:
+			ch.Due++
+			failed = true
+		case h.Quitting():
+			ch.Due++
+			if d < today {
+				ch.Done++
+			} else {
+				pending = true
+			}
+		case !h.Schedule.On(d.Weekday()), h.pausedOn(d) && !performed[d]:
+			// Not due
+		case performed[d]:
+			ch.Due++
+			ch.Done++
+		case d < today:
+			ch.Due++
+			failed = true
+		default:
+			ch.Due++
+			pending = true
+		}
+	}
+	switch {
+	case ch.Abandoned():
+		ch.Outcome = ChallengeAbandoned
+	case failed:
+		ch.Outcome = ChallengeFailed
+	case pending:
+		ch.Outcome = ChallengeRunning
+	default:
+		ch.Outcome = ChallengeSucceeded
+	}
+	return ch
+}
+
+// challengeMassage adds how the challenge of the habit is going to the
+// massage of performing it, given the challenge before and after
+func challengeMassage(massage string, h Habit, before, after *Challenge) string {
+	if before == nil || after == nil || before.ID != after.ID || !before.Running() {
+		return massage
+	}
+	if after.Outcome == ChallengeSucceeded {
+		return fmt.Sprintf("You did it: the %d-day challenge of '%s' is complete!\n", after.Days, h.Name)
+	}
+	if after.Running() && after.Done > before.Done {
+		return fmt.Sprintf("%s That's %d of %d days of your %d-day challenge done.\n", strings.TrimSuffix(massage, "\n"), after.Done, after.Due, after.Days)
+	}
+	return massage
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the stores what time it is
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the system time, used by default
+type SystemClock struct{}
+
+// Now returns the current system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock is a Clock that stands still until it is moved, which lets
+// tests fake the time. It is safe for concurrent use.
+type FixedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFixedClock returns a FixedClock set to now
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+// Now returns the time the clock is set to
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *FixedClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Add moves the clock on by d
+func (c *FixedClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// AddDate moves the clock on by the given number of years, months and days
+func (c *FixedClock) AddDate(years, months, days int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.AddDate(years, months, days)
+}
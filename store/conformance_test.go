@@ -0,0 +1,1824 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/miloszizic/habits/store"
+)
+
+// storeFactory returns an empty store counting days in the calendar, whose
+// clock is frozen at fakeNow(), together with a function that moves that clock
+type storeFactory func(t *testing.T, calendar store.Calendar) (store.Store, func(now time.Time))
+
+// testHabitStore is the conformance suite every HabitStore backend must pass
+func testHabitStore(t *testing.T, newStore storeFactory) {
+	tests := map[string]func(*testing.T, store.HabitStore, func(time.Time)){
+		"AddAndGetHabit":                     testConformanceAddAndGet,
+		"AddRejectsDuplicateNames":           testConformanceAddDuplicate,
+		"GetMissingHabit":                    testConformanceGetMissing,
+		"GetHabitByID":                       testConformanceGetByID,
+		"DeleteHabit":                        testConformanceDelete,
+		"AllHabits":                          testConformanceAllHabits,
+		"PerformBuildsStreakFromHistory":     testConformanceStreak,
+		"PerformTwiceOnTheSameDay":           testConformancePerformTwice,
+		"PerformResetsStreakAfterMissedDays": testConformanceStreakReset,
+		"PerformDeletedHabit":                testConformancePerformDeleted,
+		"WeekdayScheduleSkipsOffDays":        testConformanceWeekdaySchedule,
+		"WeeklyTargetCountsWeeks":            testConformanceWeeklyTarget,
+		"QuantitativeHabitAddsUpAmounts":     testConformanceQuantitative,
+		"QuantitativeHabitRejectsBadAmounts": testConformanceQuantitativeInvalid,
+		"QuitHabitCountsDaysSinceRelapse":    testConformanceQuit,
+		"QuitHabitRejectsTargetsAndBuild":    testConformanceQuitInvalid,
+		"UpdateKeepsIDAndHistory":            testConformanceUpdate,
+		"UpdateRejectsTakenNamesAndKinds":    testConformanceUpdateInvalid,
+		"PausedDaysKeepTheStreak":            testConformancePause,
+		"PausedWeeksKeepTheStreak":           testConformancePauseWeekly,
+		"PauseRejectsQuitAndBackwardRanges":  testConformancePauseInvalid,
+		"ResumeEndsThePauses":                testConformanceResume,
+		"ArchivedHabitsKeepTheirHistory":     testConformanceArchive,
+		"LongestStreakOutlivesTheStreak":     testConformanceLongestStreak,
+		"BackfillMendsTheStreak":             testConformanceBackfill,
+		"BackfillRejectsDaysOutOfTheWindow":  testConformanceBackfillInvalid,
+		"UndoRestoresThePreviousState":       testConformanceUndo,
+		"StatsSumUpTheHistory":               testConformanceStats,
+		"ChallengesEndInAnOutcome":           testConformanceChallenge,
+		"ChallengesOfHabitsToQuit":           testConformanceChallengeQuit,
+		"ChallengeRejectsBadRequests":        testConformanceChallengeInvalid,
+		"CanceledContext":                    testConformanceCanceled,
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s, setNow := newStore(t, store.Calendar{})
+			tc(t, s, setNow)
+		})
+	}
+	userTests := map[string]func(*testing.T, store.Store, func(time.Time)){
+		"SignUpAndAuthenticate":         testConformanceUsers,
+		"SignUpRejectsBadAccounts":      testConformanceUsersInvalid,
+		"HabitsBelongToTheirUser":       testConformanceOwnership,
+		"SessionsSignUsersIn":           testConformanceSessions,
+		"SessionsExpire":                testConformanceSessionExpiry,
+		"DeleteUserSessionsSignsAllOut": testConformanceLogoutEverywhere,
+		"APITokensSignScriptsIn":        testConformanceTokens,
+		"RevokedTokensStopWorking":      testConformanceTokenRevoke,
+	}
+	for name, tc := range userTests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s, setNow := newStore(t, store.Calendar{})
+			tc(t, s, setNow)
+		})
+	}
+	t.Run("DaysFollowTheCalendar", func(t *testing.T) {
+		calendar, err := store.NewCalendar("Europe/Belgrade", "04:00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, setNow := newStore(t, calendar)
+		testConformanceCalendar(t, s, setNow)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testHabitStore(t, func(t *testing.T, calendar store.Calendar) (store.Store, func(time.Time)) {
+		s := store.NewMemoryStore()
+		s.Output = io.Discard
+		clock := store.NewFixedClock(fakeNow())
+		s.Clock = clock
+		s.Calendar = calendar
+		return s, clock.Set
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testHabitStore(t, func(t *testing.T, calendar store.Calendar) (store.Store, func(time.Time)) {
+		s, err := store.FromSQLite(t.TempDir() + "/habits.db")
+		if err != nil {
+			t.Fatalf("FromSQLite() err = %v; want %v", err, nil)
+		}
+		t.Cleanup(func() { s.Close() })
+		s.Output = io.Discard
+		clock := store.NewFixedClock(fakeNow())
+		s.Clock = clock
+		s.Calendar = calendar
+		return s, clock.Set
+	})
+}
+
+func TestSQLiteStoreKeepsOnlyHashesOfSessionTokens(t *testing.T) {
+	s, err := store.FromSQLite(t.TempDir() + "/habits.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	user := addUser(t, s, "ana@example.com")
+	session, err := s.CreateSession(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	err = s.DB.QueryRow(`SELECT token_hash FROM sessions`).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == session.Token || strings.Contains(stored, session.Token) {
+		t.Errorf("sessions table holds the token %q itself", stored)
+	}
+}
+
+func TestSQLiteStoreKeepsOnlyHashesOfAPITokens(t *testing.T) {
+	s, err := store.FromSQLite(t.TempDir() + "/habits.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	user := addUser(t, s, "ana@example.com")
+	token, err := s.CreateToken(context.Background(), user.ID, "cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	err = s.DB.QueryRow(`SELECT token_hash FROM api_tokens`).Scan(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == token.Token || strings.Contains(stored, token.Token) {
+		t.Errorf("api_tokens table holds the token %q itself", stored)
+	}
+}
+
+func TestSQLiteStoreKeepsHabitNamesUniquePerUser(t *testing.T) {
+	s, err := store.FromSQLite(t.TempDir() + "/habits.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	insert := `INSERT INTO habits (user_id, name, LastPerformed, streak) VALUES (?,?,?,0)`
+	if _, err := s.DB.Exec(insert, 1, "Go", fakeNow()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.Exec(insert, 2, "Go", fakeNow()); err != nil {
+		t.Errorf("another user can't have a habit of the same name: %v", err)
+	}
+	if _, err := s.DB.Exec(insert, 1, "Go", fakeNow()); err == nil {
+		t.Error("the database took a second habit of the same user and name")
+	}
+}
+
+func TestMemoryStoreIsSafeForConcurrentUse(t *testing.T) {
+	s := store.NewMemoryStore()
+	s.Output = io.Discard
+	s.Clock = store.NewFixedClock(fakeNow())
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("habit %d", i)
+			if err := s.Add(ctx, store.Habit{Name: name}); err != nil {
+				t.Error(err)
+				return
+			}
+			h, err := s.GetHabit(ctx, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := s.PerformHabit(ctx, *h, 1); err != nil {
+				t.Error(err)
+			}
+			if _, err := s.AllHabits(ctx); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	habits, err := s.AllHabits(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(habits) != 20 {
+		t.Errorf("got %d habits; want 20", len(habits))
+	}
+}
+
+func testConformanceAddAndGet(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "CCNA", Description: "networking exam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &store.Habit{Name: "CCNA", Description: "networking exam", Kind: store.BuildHabit, LastPerformed: fakeNow(), Streak: 0}
+	got, err := s.GetHabit(ctx, "CCNA")
+	if err != nil {
+		t.Fatalf("got an error getting Habit: %v", err)
+	}
+	if got.ID == 0 {
+		t.Error("added habit has no ID")
+	}
+	if !cmp.Equal(want, got, cmpopts.IgnoreFields(store.Habit{}, "ID")) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func testConformanceAddDuplicate(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Add(ctx, store.Habit{Name: "Go"})
+	if !errors.Is(err, store.ErrExists) {
+		t.Errorf("adding a duplicate: wanted ErrExists, got %v", err)
+	}
+}
+
+func testConformanceGetMissing(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	_, err := s.GetHabit(context.Background(), "missing")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceDelete(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	setNow(fakeNow().AddDate(0, 0, 1))
+	if _, err := s.PerformHabit(ctx, *habit, 1); err != nil {
+		t.Fatal(err)
+	}
+	err := s.DeleteHabit(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetHabit(ctx, "Go")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("wanted ErrNotFound, got %v", err)
+	}
+	history, err := s.History(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("deleted habit still has %d check-ins", len(history))
+	}
+	err = s.DeleteHabit(ctx, habit.ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting a missing habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceGetByID(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	addAndGet(t, s, "read")
+	got, err := s.GetHabitByID(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(habit, got); diff != "" {
+		t.Error(diff)
+	}
+	renamed := *habit
+	renamed.Name = "golang"
+	if err := s.UpdateHabit(ctx, renamed); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetHabitByID(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "golang" {
+		t.Errorf("habit %d is named %q after renaming it; want golang", habit.ID, got.Name)
+	}
+	if _, err := s.GetHabitByID(ctx, habit.ID+100); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting a missing habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceAllHabits(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	got, err := s.AllHabits(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("empty store lists %d habits", len(got))
+	}
+	want := []string{"Go", "SQL", "k8s"}
+	for _, name := range want {
+		addAndGet(t, s, name)
+	}
+	habits, err := s.AllHabits(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, h := range habits {
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+	if !cmp.Equal(want, names) {
+		t.Error(cmp.Diff(want, names))
+	}
+}
+
+func testConformanceStreak(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "piano")
+	for day := 1; day <= 17; day++ {
+		setNow(fakeNow().AddDate(0, 0, day))
+		habit := get(t, s, "piano")
+		massage, err := s.PerformHabit(ctx, *habit, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if day == 17 {
+			want := "You're currently on a 17-day streak for 'piano'. Stick to it!\n"
+			if massage != want {
+				t.Errorf("got massage %q; want %q", massage, want)
+			}
+		}
+	}
+	habit := get(t, s, "piano")
+	if habit.Streak != 17 {
+		t.Errorf("got streak %d; want 17", habit.Streak)
+	}
+	if want := fakeNow().AddDate(0, 0, 17); !habit.LastPerformed.Equal(want) {
+		t.Errorf("got LastPerformed %v; want %v", habit.LastPerformed, want)
+	}
+	history, err := s.History(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 17 {
+		t.Errorf("got %d check-ins; want 17", len(history))
+	}
+	if got := (store.Calendar{}).Streak(history, *habit); got != habit.Streak {
+		t.Errorf("streak derived from history is %d; habit has %d", got, habit.Streak)
+	}
+}
+
+func testConformancePerformTwice(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	stale := *addAndGet(t, s, "Go")
+	setNow(fakeNow().AddDate(0, 0, 1))
+	if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 1).Add(time.Hour))
+	massage, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "You already perfromed 'Go' habit today. Your current streak is 1 days in a row.\n"
+	if massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	// A form posted twice, or two requests at once, perform the habit as it
+	// was before either of them
+	massage, err = s.PerformHabit(ctx, stale, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if massage != want {
+		t.Errorf("got massage %q performing a stale habit; want %q", massage, want)
+	}
+	history, err := s.History(ctx, *get(t, s, "Go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("got %d check-ins; want 1", len(history))
+	}
+}
+
+func testConformanceStreakReset(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "Cycling")
+	for _, day := range []int{1, 2, 3} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "Cycling"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setNow(fakeNow().AddDate(0, 0, 6))
+	massage, err := s.PerformHabit(ctx, *get(t, s, "Cycling"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "You last did the habit 'Cycling' 3 days ago, so you're starting a new streak today. Good luck!\n"
+	if massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	if got := get(t, s, "Cycling").Streak; got != 1 {
+		t.Errorf("got streak %d; want 1", got)
+	}
+}
+
+func testConformancePerformDeleted(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	if err := s.DeleteHabit(ctx, habit.ID); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 1))
+	_, err := s.PerformHabit(ctx, *habit, 1)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("performing a deleted habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceWeekdaySchedule(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	gym := store.NewWeekdaySchedule(time.Monday, time.Wednesday, time.Friday)
+	err := s.Add(ctx, store.Habit{Name: "gym", Schedule: gym})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "gym").Schedule; !cmp.Equal(gym, got) {
+		t.Fatalf("stored schedule %v; want %v", got, gym)
+	}
+	// fakeNow is a Friday, so these are Monday, Wednesday, Friday and Monday
+	for _, day := range []int{3, 5, 7, 10} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		habit := get(t, s, "gym")
+		if !habit.DueToday {
+			t.Errorf("%s: gym is not due on a scheduled day", fakeNow().AddDate(0, 0, day).Weekday())
+		}
+		if _, err := s.PerformHabit(ctx, *habit, 1); err != nil {
+			t.Fatal(err)
+		}
+		if get(t, s, "gym").DueToday {
+			t.Errorf("%s: gym is still due after performing it", fakeNow().AddDate(0, 0, day).Weekday())
+		}
+	}
+	if got := get(t, s, "gym").Streak; got != 4 {
+		t.Errorf("got streak %d; want 4", got)
+	}
+	setNow(fakeNow().AddDate(0, 0, 11))
+	if get(t, s, "gym").DueToday {
+		t.Error("gym is due on a Tuesday")
+	}
+	// Skipping Wednesday breaks the streak
+	setNow(fakeNow().AddDate(0, 0, 14))
+	if _, err := s.PerformHabit(ctx, *get(t, s, "gym"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "gym").Streak; got != 1 {
+		t.Errorf("after skipping a scheduled day got streak %d; want 1", got)
+	}
+}
+
+func testConformanceWeeklyTarget(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "run", Schedule: store.Schedule{PerWeek: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	perform := func(day int) string {
+		t.Helper()
+		setNow(fakeNow().AddDate(0, 0, day))
+		massage, err := s.PerformHabit(ctx, *get(t, s, "run"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return massage
+	}
+	// fakeNow is a Friday, so day 3 is the Monday of the next week
+	perform(3)
+	massage := perform(4)
+	if want := "Nice work: that's 2 of 3 times this week for 'run'.\n"; massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	setNow(fakeNow().AddDate(0, 0, 5))
+	habit := get(t, s, "run")
+	if !habit.DueToday || habit.TimesThisWeek != 2 || habit.Streak != 0 {
+		t.Errorf("got due %v, %d times this week and streak %d; want due, 2 times and streak 0",
+			habit.DueToday, habit.TimesThisWeek, habit.Streak)
+	}
+	massage = perform(6)
+	if want := "Nice work: you've done the habit 'run' for 1 weeks in a row.\n"; massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	setNow(fakeNow().AddDate(0, 0, 7))
+	if get(t, s, "run").DueToday {
+		t.Error("run is due after meeting the weekly target")
+	}
+	// A week in progress does not break the streak
+	perform(10)
+	if got := get(t, s, "run").Streak; got != 1 {
+		t.Errorf("got streak %d during the next week; want 1", got)
+	}
+	perform(11)
+	perform(12)
+	if got := get(t, s, "run").Streak; got != 2 {
+		t.Errorf("got streak %d; want 2", got)
+	}
+	// Missing a whole week breaks it
+	perform(24)
+	if got := get(t, s, "run").Streak; got != 0 {
+		t.Errorf("after missing a week got streak %d; want 0", got)
+	}
+}
+
+func testConformanceQuantitative(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "read", Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	perform := func(day int, amount float64, want string) {
+		t.Helper()
+		setNow(fakeNow().AddDate(0, 0, day))
+		massage, err := s.PerformHabit(ctx, *get(t, s, "read"), amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if massage != want {
+			t.Errorf("got massage %q; want %q", massage, want)
+		}
+	}
+	perform(1, 5, "Logged 5 pages of 'read': that's 5 of 20 pages today.\n")
+	habit := get(t, s, "read")
+	if habit.Target != 20 || habit.Unit != "pages" {
+		t.Errorf("got target %g %s; want 20 pages", habit.Target, habit.Unit)
+	}
+	if !habit.DueToday || habit.Progress != 5 || habit.Streak != 0 {
+		t.Errorf("got due %v, progress %g and streak %d; want due, progress 5 and streak 0",
+			habit.DueToday, habit.Progress, habit.Streak)
+	}
+	perform(1, 15, "Nice work: you've done the habit 'read' for 1 days in a row.\n")
+	perform(1, 5.5, "Logged 5.5 more pages of 'read': that's 25.5 of 20 pages today. Your current streak is 1 days in a row.\n")
+	habit = get(t, s, "read")
+	if habit.DueToday || habit.Progress != 25.5 {
+		t.Errorf("got due %v and progress %g; want done with progress 25.5", habit.DueToday, habit.Progress)
+	}
+	// Running short on a day does not count, but only breaks the streak
+	// once that day is over
+	perform(2, 10, "Logged 10 pages of 'read': that's 10 of 20 pages today.\n")
+	if got := get(t, s, "read").Streak; got != 1 {
+		t.Errorf("got streak %d while short of the target; want 1", got)
+	}
+	perform(3, 20, "You reached your target for 'read' today, so you're starting a new streak. Good luck!\n")
+	if got := get(t, s, "read").Streak; got != 1 {
+		t.Errorf("got streak %d after a short day; want 1", got)
+	}
+	history, err := s.History(ctx, *get(t, s, "read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var amounts []float64
+	for _, c := range history {
+		amounts = append(amounts, c.Amount)
+	}
+	if want := []float64{5, 15, 5.5, 10, 20}; !cmp.Equal(want, amounts) {
+		t.Error(cmp.Diff(want, amounts))
+	}
+}
+
+func testConformanceQuantitativeInvalid(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "water", Target: -2, Unit: "l"})
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("adding a negative target: wanted ErrInvalid, got %v", err)
+	}
+	err = s.Add(ctx, store.Habit{Name: "water", Target: 2, Unit: "l"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 1))
+	for _, amount := range []float64{0, -1} {
+		_, err = s.PerformHabit(ctx, *get(t, s, "water"), amount)
+		if !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("performing with amount %g: wanted ErrInvalid, got %v", amount, err)
+		}
+	}
+}
+
+func testConformanceQuit(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 5))
+	habit := get(t, s, "sugar")
+	if !habit.Quitting() || habit.Streak != 5 || habit.DueToday {
+		t.Errorf("got kind %q, streak %d and due %v; want quit, 5 days and not due", habit.Kind, habit.Streak, habit.DueToday)
+	}
+	// Performing a habit to quit only reports how it's going
+	massage, err := s.PerformHabit(ctx, *habit, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "You've stayed away from 'sugar' for 5 days. Keep it up!\n"; massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	massage, err = s.Relapse(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "You slipped on 'sugar' after 5 days. The count starts over today, you can do it!\n"; massage != want {
+		t.Errorf("got massage %q; want %q", massage, want)
+	}
+	if got := get(t, s, "sugar").Streak; got != 0 {
+		t.Errorf("got streak %d right after relapse; want 0", got)
+	}
+	setNow(fakeNow().AddDate(0, 0, 7))
+	if got := get(t, s, "sugar").Streak; got != 2 {
+		t.Errorf("got streak %d two days after relapse; want 2", got)
+	}
+	history, err := s.History(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || !history[0].PerformedAt.Equal(fakeNow().AddDate(0, 0, 5)) {
+		t.Errorf("got history %v; want the one relapse", history)
+	}
+}
+
+func testConformanceQuitInvalid(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	habits := map[string]store.Habit{
+		"with target":   {Name: "smoking", Kind: store.QuitHabit, Target: 5},
+		"with schedule": {Name: "smoking", Kind: store.QuitHabit, Schedule: store.Schedule{PerWeek: 3}},
+		"unknown kind":  {Name: "smoking", Kind: "maybe"},
+	}
+	for name, habit := range habits {
+		err := s.Add(ctx, habit)
+		if !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("adding a habit %s: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+	err := s.Add(ctx, store.Habit{Name: "CCNA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Relapse(ctx, *get(t, s, "CCNA"))
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("relapse on a habit to build: wanted ErrInvalid, got %v", err)
+	}
+}
+
+func testConformanceUpdate(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "Go")
+	for day := 1; day <= 3; day++ {
+		setNow(fakeNow().AddDate(0, 0, day))
+		_, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	habit := get(t, s, "Go")
+	changed := *habit
+	changed.Name = "golang"
+	changed.Description = "an hour of exercises"
+	changed.Schedule = store.Schedule{PerWeek: 2}
+	err := s.UpdateHabit(ctx, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetHabit(ctx, "Go")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting the old name: wanted ErrNotFound, got %v", err)
+	}
+	updated := get(t, s, "golang")
+	if updated.ID != habit.ID || updated.Schedule.String() != "2/week" || updated.Description != "an hour of exercises" {
+		t.Errorf("got habit %d on %s described %q; want habit %d on 2/week with its description", updated.ID, updated.Schedule, updated.Description, habit.ID)
+	}
+	// Saturday and Sunday met the target of their week, while the week of
+	// Monday is still running, and the streak is counted in weeks now
+	if updated.Streak != 1 {
+		t.Errorf("got streak %d under the new schedule; want 1", updated.Streak)
+	}
+	history, err := s.History(ctx, *updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Errorf("got %d check-ins after renaming; want 3", len(history))
+	}
+	changed = *updated
+	changed.Schedule = store.Schedule{}
+	changed.Target = 10
+	changed.Unit = "minutes"
+	err = s.UpdateHabit(ctx, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "golang").Streak; got != 0 {
+		t.Errorf("got streak %d after raising the target above every check-in; want 0", got)
+	}
+}
+
+func testConformanceUpdateInvalid(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "Go")
+	habit := addAndGet(t, s, "piano")
+	changed := *habit
+	changed.Name = "Go"
+	err := s.UpdateHabit(ctx, changed)
+	if !errors.Is(err, store.ErrExists) {
+		t.Errorf("renaming to a taken name: wanted ErrExists, got %v", err)
+	}
+	changed = *habit
+	changed.Kind = store.QuitHabit
+	err = s.UpdateHabit(ctx, changed)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("changing the kind: wanted ErrInvalid, got %v", err)
+	}
+	changed = *habit
+	changed.Name = " "
+	err = s.UpdateHabit(ctx, changed)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("clearing the name: wanted ErrInvalid, got %v", err)
+	}
+	changed = *habit
+	changed.Description = strings.Repeat("a", 501)
+	err = s.UpdateHabit(ctx, changed)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("describing at length: wanted ErrInvalid, got %v", err)
+	}
+	changed = *habit
+	changed.ID = 404
+	err = s.UpdateHabit(ctx, changed)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("updating a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	if got := get(t, s, "piano"); got.Name != "piano" || !got.Schedule.Daily() {
+		t.Errorf("failed updates changed the habit to %+v", got)
+	}
+}
+
+// testConformanceCalendar runs in Belgrade, two hours ahead of UTC in
+// October 2021, with days starting at 04:00
+func testConformancePause(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Cycling")
+	perform := func(name string, days ...int) {
+		t.Helper()
+		for _, day := range days {
+			setNow(fakeNow().AddDate(0, 0, day))
+			if _, err := s.PerformHabit(ctx, *get(t, s, name), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	perform("Cycling", 1, 2, 3)
+	err := s.PauseHabit(ctx, habit.ID, fakeNow().AddDate(0, 0, 4), fakeNow().AddDate(0, 0, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 5))
+	paused := get(t, s, "Cycling")
+	if !paused.PausedToday || paused.DueToday || len(paused.Pauses) != 1 {
+		t.Errorf("got habit paused today %v, due %v with pauses %+v; want paused and not due", paused.PausedToday, paused.DueToday, paused.Pauses)
+	}
+	perform("Cycling", 7)
+	if got := get(t, s, "Cycling"); got.Streak != 4 || got.PausedToday {
+		t.Errorf("got streak %d after the pause; want 4", got.Streak)
+	}
+
+	// Pausing days already missed mends the streak
+	piano := addAndGet(t, s, "piano")
+	perform("piano", 8, 9, 11)
+	if got := get(t, s, "piano").Streak; got != 1 {
+		t.Fatalf("got streak %d after a missed day; want 1", got)
+	}
+	day10 := fakeNow().AddDate(0, 0, 10)
+	err = s.PauseHabit(ctx, piano.ID, day10, day10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "piano").Streak; got != 3 {
+		t.Errorf("got streak %d after pausing the missed day; want 3", got)
+	}
+}
+
+func testConformancePauseWeekly(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "run", Schedule: store.Schedule{PerWeek: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := get(t, s, "run")
+	// Mondays and Tuesdays of the weeks before and after the week of 25 October
+	for _, day := range []int{3, 4, 17, 18} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "run"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := get(t, s, "run").Streak; got != 1 {
+		t.Fatalf("got streak %d after a missed week; want 1", got)
+	}
+	err = s.PauseHabit(ctx, run.ID, fakeNow().AddDate(0, 0, 12), fakeNow().AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "run").Streak; got != 2 {
+		t.Errorf("got streak %d after pausing part of the missed week; want 2", got)
+	}
+}
+
+func testConformancePauseInvalid(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	err := s.PauseHabit(ctx, habit.ID, fakeNow().AddDate(0, 0, 2), fakeNow().AddDate(0, 0, 1))
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("pausing until before the start: wanted ErrInvalid, got %v", err)
+	}
+	err = s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.PauseHabit(ctx, get(t, s, "sugar").ID, fakeNow(), fakeNow())
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("pausing a habit to quit: wanted ErrInvalid, got %v", err)
+	}
+	err = s.PauseHabit(ctx, 404, fakeNow(), fakeNow())
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("pausing a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	if got := get(t, s, "Go").Pauses; len(got) != 0 {
+		t.Errorf("got pauses %+v after failed pauses; want none", got)
+	}
+}
+
+func testConformanceResume(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	date := func(day int) time.Time {
+		return fakeNow().AddDate(0, 0, day)
+	}
+	for _, days := range [][2]int{{20, 25}, {2, 10}} {
+		if err := s.PauseHabit(ctx, habit.ID, date(days[0]), date(days[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pauses := get(t, s, "Go").Pauses
+	if len(pauses) != 2 || pauses[0].From.Format("2006-01-02") != "2021-10-17" || pauses[1].Until.Format("2006-01-02") != "2021-11-09" {
+		t.Fatalf("got pauses %+v; want 17 to 25 October and 4 to 9 November", pauses)
+	}
+	setNow(date(4))
+	err := s.ResumeHabit(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := get(t, s, "Go")
+	if got.PausedToday || !got.DueToday {
+		t.Errorf("got habit paused today %v and due %v after resuming; want due", got.PausedToday, got.DueToday)
+	}
+	if len(got.Pauses) != 1 || got.Pauses[0].From.Format("2006-01-02") != "2021-10-17" || got.Pauses[0].Until.Format("2006-01-02") != "2021-10-18" {
+		t.Errorf("got pauses %+v after resuming on 19 October; want 17 to 18 October", got.Pauses)
+	}
+	if err := s.ResumeHabit(ctx, 404); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("resuming a missing habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceArchive(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	setNow(fakeNow().AddDate(0, 0, 1))
+	if _, err := s.PerformHabit(ctx, *habit, 1); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 2))
+	if err := s.ArchiveHabit(ctx, habit.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	archived := get(t, s, "Go")
+	if !archived.Archived() || !archived.ArchivedAt.Equal(fakeNow().AddDate(0, 0, 2)) || archived.DueToday || archived.Streak != 1 {
+		t.Errorf("got habit archived at %v, due %v with streak %d; want archived now with its streak", archived.ArchivedAt, archived.DueToday, archived.Streak)
+	}
+	all, err := s.AllHabits(ctx)
+	if err != nil || len(all) != 1 || !all[0].Archived() {
+		t.Errorf("got habits %+v, %v; want the archived one", all, err)
+	}
+	_, err = s.PerformHabit(ctx, *archived, 1)
+	if !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("performing an archived habit: wanted ErrInvalid, got %v", err)
+	}
+	history, err := s.History(ctx, *archived)
+	if err != nil || len(history) != 1 {
+		t.Errorf("got history %+v, %v of the archived habit; want its check-in", history, err)
+	}
+	if err := s.ArchiveHabit(ctx, habit.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "Go"); got.Archived() || !got.DueToday {
+		t.Errorf("got habit archived %v and due %v after restoring; want it due", got.Archived(), got.DueToday)
+	}
+	if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+		t.Errorf("performing a restored habit: %v", err)
+	}
+	if err := s.ArchiveHabit(ctx, 404, true); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("archiving a missing habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceLongestStreak(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "Go")
+	for _, day := range []int{1, 2, 3, 5} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := get(t, s, "Go"); got.Streak != 1 || got.LongestStreak != 3 {
+		t.Errorf("got streak %d, longest %d; want 1 and 3", got.Streak, got.LongestStreak)
+	}
+
+	err := s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 9))
+	if _, err := s.Relapse(ctx, *get(t, s, "sugar")); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 11))
+	if got := get(t, s, "sugar"); got.Streak != 2 || got.LongestStreak != 4 {
+		t.Errorf("got %d days clean, longest %d; want 2 and 4", got.Streak, got.LongestStreak)
+	}
+	setNow(fakeNow().AddDate(0, 0, 20))
+	if got := get(t, s, "sugar"); got.LongestStreak != 11 {
+		t.Errorf("got longest %d days clean; want the running 11", got.LongestStreak)
+	}
+}
+
+func testConformanceBackfill(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	for _, day := range []int{1, 2, 4} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := get(t, s, "Go"); got.Streak != 1 {
+		t.Fatalf("got streak %d after a missed day; want 1", got.Streak)
+	}
+	day3 := fakeNow().AddDate(0, 0, 3)
+	err := s.LogCheckIn(ctx, habit.ID, day3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := get(t, s, "Go")
+	if got.Streak != 4 || got.LongestStreak != 4 || !got.LastPerformed.Equal(fakeNow().AddDate(0, 0, 4)) {
+		t.Errorf("got streak %d, longest %d, last performed %v after logging the missed day; want 4, 4 and the last check-in", got.Streak, got.LongestStreak, got.LastPerformed)
+	}
+	err = s.LogCheckIn(ctx, habit.ID, day3, 1)
+	if !errors.Is(err, store.ErrExists) {
+		t.Errorf("logging a day twice: wanted ErrExists, got %v", err)
+	}
+	history, err := s.History(ctx, *habit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 || !history[2].PerformedAt.Before(history[3].PerformedAt) {
+		t.Fatalf("got history %+v; want the logged day in order", history)
+	}
+
+	// Removing a check-in breaks the streak again, and removing the last one
+	// moves the last performance back
+	err = s.DeleteCheckIn(ctx, habit.ID, history[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "Go"); got.Streak != 2 || got.LongestStreak != 2 {
+		t.Errorf("got streak %d, longest %d after removing day 2; want 2 and 2", got.Streak, got.LongestStreak)
+	}
+	err = s.DeleteCheckIn(ctx, habit.ID, history[3].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = get(t, s, "Go")
+	if got.Streak != 1 || !got.DueToday || got.LastPerformed.After(day3) {
+		t.Errorf("got streak %d, due %v, last performed %v after removing today; want 1 and due", got.Streak, got.DueToday, got.LastPerformed)
+	}
+	err = s.DeleteCheckIn(ctx, habit.ID, history[3].ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("removing a check-in twice: wanted ErrNotFound, got %v", err)
+	}
+
+	// Amounts logged for a day add up to the target
+	err = s.Add(ctx, store.Habit{Name: "read", Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := get(t, s, "read")
+	for _, amount := range []float64{5, 15} {
+		if err := s.LogCheckIn(ctx, read.ID, day3, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := get(t, s, "read"); got.Streak != 1 || got.Progress != 0 {
+		t.Errorf("got streak %d, progress %v; want yesterday's target met and nothing today", got.Streak, got.Progress)
+	}
+}
+
+func testConformanceBackfillInvalid(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	setNow(fakeNow().AddDate(0, 0, 10))
+	for name, date := range map[string]time.Time{
+		"a day still to come":     fakeNow().AddDate(0, 0, 11),
+		"a day out of the window": fakeNow().AddDate(0, 0, 10-store.DefaultBackfillDays-1),
+	} {
+		if err := s.LogCheckIn(ctx, habit.ID, date, 1); !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("logging %s: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+	if err := s.LogCheckIn(ctx, habit.ID, fakeNow().AddDate(0, 0, 10-store.DefaultBackfillDays), 1); err != nil {
+		t.Errorf("logging the first day of the window: %v", err)
+	}
+	if err := s.LogCheckIn(ctx, 404, fakeNow(), 1); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("logging a check-in of a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	err := s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LogCheckIn(ctx, get(t, s, "sugar").ID, fakeNow().AddDate(0, 0, 9), 1); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("logging a relapse: wanted ErrInvalid, got %v", err)
+	}
+
+	// Check-ins that fell out of the window stay put
+	setNow(fakeNow().AddDate(0, 0, 30))
+	history, err := s.History(ctx, *habit)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("got history %+v, %v; want the logged check-in", history, err)
+	}
+	if err := s.DeleteCheckIn(ctx, habit.ID, history[0].ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("removing an old check-in: wanted ErrInvalid, got %v", err)
+	}
+}
+
+func testConformanceUndo(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	for _, day := range []int{1, 2} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := get(t, s, "Go")
+	setNow(fakeNow().AddDate(0, 0, 3))
+	if _, err := s.PerformHabit(ctx, *before, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "Go"); got.Streak != 3 || got.LongestStreak != 3 {
+		t.Fatalf("got streak %d, longest %d; want 3 and 3", got.Streak, got.LongestStreak)
+	}
+	setNow(fakeNow().AddDate(0, 0, 3).Add(store.UndoWindow))
+	err := s.UndoPerform(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := get(t, s, "Go")
+	if got.Streak != before.Streak || got.LongestStreak != before.LongestStreak || !got.LastPerformed.Equal(before.LastPerformed) || !got.DueToday {
+		t.Errorf("got streak %d, longest %d, last performed %v, due %v after undoing; want %d, %d, %v and due",
+			got.Streak, got.LongestStreak, got.LastPerformed, got.DueToday, before.Streak, before.LongestStreak, before.LastPerformed)
+	}
+	history, err := s.History(ctx, *habit)
+	if err != nil || len(history) != 2 {
+		t.Errorf("got history %+v, %v after undoing; want the two earlier check-ins", history, err)
+	}
+	if err := s.UndoPerform(ctx, habit.ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("undoing a check-in of yesterday: wanted ErrInvalid, got %v", err)
+	}
+
+	// Undoing the only check-in brings back when the habit was started
+	err = s.Add(ctx, store.Habit{Name: "read", Target: 20, Unit: "pages"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := get(t, s, "read")
+	setNow(fakeNow().AddDate(0, 0, 4))
+	if _, err := s.PerformHabit(ctx, *read, 5); err != nil {
+		t.Fatal(err)
+	}
+	err = s.UndoPerform(ctx, read.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "read"); got.Progress != 0 || got.Streak != 0 || !got.LastPerformed.Equal(read.LastPerformed) {
+		t.Errorf("got progress %v, streak %d, last performed %v after undoing; want nothing and %v", got.Progress, got.Streak, got.LastPerformed, read.LastPerformed)
+	}
+
+	// Performs recorded longer than UndoWindow ago stay put
+	if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 4).Add(store.UndoWindow + time.Minute))
+	if err := s.UndoPerform(ctx, habit.ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("undoing an old perform: wanted ErrInvalid, got %v", err)
+	}
+	if err := s.UndoPerform(ctx, 404); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("undoing a perform of a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	err = s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Relapse(ctx, *get(t, s, "sugar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UndoPerform(ctx, get(t, s, "sugar").ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("undoing a relapse: wanted ErrInvalid, got %v", err)
+	}
+}
+
+func testConformanceStats(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	for _, day := range []int{1, 2, 4} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setNow(fakeNow().AddDate(0, 0, 5))
+	stats, err := s.Stats(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.LongestStreak != 2 || stats.CheckIns != 3 || stats.Total != 3 || stats.PerWeek != 3 {
+		t.Errorf("got stats %+v; want the longest streak of 2 and 3 check-ins in the first week", stats)
+	}
+	if len(stats.Completion) != len(store.StatsWindows) {
+		t.Fatalf("got completion %+v; want one for each of %v", stats.Completion, store.StatsWindows)
+	}
+	// Today is still to come, and the days before the first check-in don't count
+	for i, want := range []store.Completion{{Days: 7, Due: 4, Done: 3}, {Days: 30, Due: 4, Done: 3}} {
+		if got := stats.Completion[i]; got != want || got.Percent() != 75 {
+			t.Errorf("got completion %+v; want %+v, 75%%", got, want)
+		}
+	}
+	year := stats.Year
+	if len(year) < 52*7+1 || len(year) > 53*7 || year[0].Date.Weekday() != time.Monday {
+		t.Fatalf("got %d days starting on %v; want the weeks of the last year", len(year), year[0].Date.Weekday())
+	}
+	yesterday, today := year[len(year)-2], year[len(year)-1]
+	if y, m, d := fakeNow().AddDate(0, 0, 5).Date(); today.Date != time.Date(y, m, d, 0, 0, 0, 0, time.UTC) || today.CheckIns != 0 {
+		t.Errorf("got %+v as the last day; want today with nothing checked in", today)
+	}
+	if !yesterday.Performed || yesterday.CheckIns != 1 || yesterday.Amount != 1 {
+		t.Errorf("got %+v for yesterday; want it performed", yesterday)
+	}
+
+	err = s.Add(ctx, store.Habit{Name: "run", Schedule: store.Schedule{PerWeek: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := get(t, s, "run")
+	for _, day := range []int{6, 12} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		if _, err := s.PerformHabit(ctx, *get(t, s, "run"), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setNow(fakeNow().AddDate(0, 0, 13))
+	stats, err = s.Stats(ctx, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last 7 days start on Friday, leaving three days of last week that
+	// ask for one of the two times, and the Thursday before doesn't count.
+	// Once so far this week.
+	if got, want := stats.Completion[0], (store.Completion{Days: 7, Due: 2, Done: 1}); got != want {
+		t.Errorf("got weekly completion %+v; want %+v", got, want)
+	}
+	// The last 30 days start with the first check-in on Thursday, leaving
+	// four days of last week that ask for both times
+	if got, want := stats.Completion[1], (store.Completion{Days: 30, Due: 3, Done: 2}); got != want {
+		t.Errorf("got weekly completion %+v; want %+v", got, want)
+	}
+
+	err = s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 14))
+	if _, err := s.Relapse(ctx, *get(t, s, "sugar")); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 17))
+	stats, err = s.Stats(ctx, get(t, s, "sugar").ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats.Completion[0], (store.Completion{Days: 7, Due: 4, Done: 3}); got != want || stats.Streak != 3 || stats.CheckIns != 1 {
+		t.Errorf("got stats %+v; want 3 of 4 days clean", stats)
+	}
+	if _, err := s.Stats(ctx, 404); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting the stats of a missing habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceCalendar(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	addAndGet(t, s, "Go")
+	perform := func(now time.Time, want string) {
+		t.Helper()
+		setNow(now)
+		massage, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if massage != want {
+			t.Errorf("got massage %q; want %q", massage, want)
+		}
+	}
+	// 03:30 on Sunday in Belgrade still counts for Saturday, while 05:00
+	// the same morning counts for Sunday, although both are on Sunday in UTC
+	perform(time.Date(2021, 10, 17, 1, 30, 0, 0, time.UTC), "Nice work: you've done the habit 'Go' for 1 days in a row.\n")
+	perform(time.Date(2021, 10, 17, 3, 0, 0, 0, time.UTC), "Nice work: you've done the habit 'Go' for 2 days in a row.\n")
+	habit := get(t, s, "Go")
+	if habit.Streak != 2 {
+		t.Errorf("got streak %d; want 2", habit.Streak)
+	}
+	if got := habit.LastPerformed.Location().String(); got != "Europe/Belgrade" {
+		t.Errorf("got LastPerformed in %s; want Europe/Belgrade", got)
+	}
+	setNow(time.Date(2021, 10, 18, 1, 0, 0, 0, time.UTC))
+	if get(t, s, "Go").DueToday {
+		t.Error("habit is due again before the day starts at 04:00")
+	}
+	setNow(time.Date(2021, 10, 18, 2, 30, 0, 0, time.UTC))
+	if !get(t, s, "Go").DueToday {
+		t.Error("habit is not due once the day started at 04:00")
+	}
+}
+
+func testConformanceCanceled(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Add(ctx, store.Habit{Name: "Go"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Add() err = %v; want context.Canceled", err)
+	}
+	if _, err := s.AllHabits(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("AllHabits() err = %v; want context.Canceled", err)
+	}
+	if _, err := s.GetHabit(ctx, "Go"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetHabit() err = %v; want context.Canceled", err)
+	}
+}
+
+func testConformanceUsers(t *testing.T, s store.Store, _ func(time.Time)) {
+	ctx := context.Background()
+	user, err := s.AddUser(ctx, " Ana@Example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Email != "ana@example.com" || !user.CreatedAt.Equal(fakeNow()) {
+		t.Errorf("got user %+v", user)
+	}
+	if user.PasswordHash == "" || user.PasswordHash == "correct horse" {
+		t.Errorf("got password hash %q; want a bcrypt hash", user.PasswordHash)
+	}
+	got, err := s.Authenticate(ctx, "ana@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("authenticated user %d; want %d", got.ID, user.ID)
+	}
+	got, err = s.GetUser(ctx, user.ID)
+	if err != nil || got.Email != user.Email {
+		t.Errorf("GetUser() = %+v, %v; want %+v", got, err, user)
+	}
+	_, err = s.GetUser(ctx, user.ID+1)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting a missing user: wanted ErrNotFound, got %v", err)
+	}
+	_, err = s.Authenticate(ctx, "ana@example.com", "wrong horse")
+	if !errors.Is(err, store.ErrWrongPassword) {
+		t.Errorf("wrong password: wanted ErrWrongPassword, got %v", err)
+	}
+	_, err = s.Authenticate(ctx, "bob@example.com", "correct horse")
+	if !errors.Is(err, store.ErrWrongPassword) {
+		t.Errorf("unknown email: wanted ErrWrongPassword, got %v", err)
+	}
+	_, err = s.AddUser(ctx, "ANA@example.com", "another password")
+	if !errors.Is(err, store.ErrEmailTaken) {
+		t.Errorf("signing up twice: wanted ErrEmailTaken, got %v", err)
+	}
+}
+
+func testConformanceUsersInvalid(t *testing.T, s store.Store, _ func(time.Time)) {
+	invalid := map[string]struct{ email, password string }{
+		"no email":       {"", "correct horse"},
+		"bad email":      {"ana", "correct horse"},
+		"short password": {"ana@example.com", "horse"},
+		"long password":  {"ana@example.com", strings.Repeat("horse", 15)},
+	}
+	for name, tc := range invalid {
+		_, err := s.AddUser(context.Background(), tc.email, tc.password)
+		if !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("%s: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func testConformanceChallenge(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	if habit.Challenge != nil {
+		t.Fatalf("got challenge %+v of a new habit; want none", habit.Challenge)
+	}
+	err := s.StartChallenge(ctx, addAndGet(t, s, "piano").ID, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tomorrow := time.Date(2021, 10, 16, 0, 0, 0, 0, time.UTC)
+	if got := get(t, s, "piano").Challenge; !got.Start.Equal(tomorrow) || got.Day != 0 || !got.Running() {
+		t.Errorf("got challenge %+v of a habit added today; want it to start tomorrow", got)
+	}
+	setNow(fakeNow().AddDate(0, 0, 1))
+	err = s.StartChallenge(ctx, habit.ID, time.Time{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := get(t, s, "Go").Challenge
+	start := time.Date(2021, 10, 16, 0, 0, 0, 0, time.UTC)
+	if got == nil || !got.Start.Equal(start) || got.Days != 3 || got.Outcome != store.ChallengeRunning || got.Day != 1 || got.Due != 3 || got.Done != 0 {
+		t.Fatalf("got challenge %+v; want a running 3-day challenge from %v on its first day", got, start)
+	}
+	if !got.End().Equal(start.AddDate(0, 0, 2)) {
+		t.Errorf("got end %v; want %v", got.End(), start.AddDate(0, 0, 2))
+	}
+	if err := s.StartChallenge(ctx, habit.ID, time.Time{}, 0); !errors.Is(err, store.ErrExists) {
+		t.Errorf("starting a second challenge: wanted ErrExists, got %v", err)
+	}
+	massage, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(massage, "1 of 3 days of your 3-day challenge") {
+		t.Errorf("got massage %q; want the progress of the challenge", massage)
+	}
+	for _, day := range []int{2, 3} {
+		setNow(fakeNow().AddDate(0, 0, day))
+		massage, err = s.PerformHabit(ctx, *get(t, s, "Go"), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.Contains(massage, "challenge of 'Go' is complete") {
+		t.Errorf("got massage %q on the last day; want the challenge complete", massage)
+	}
+	setNow(fakeNow().AddDate(0, 0, 5))
+	if got := get(t, s, "Go").Challenge; got.Outcome != store.ChallengeSucceeded || got.Day != 3 || got.Done != 3 || got.Percent() != 100 {
+		t.Errorf("got challenge %+v after it ended; want it succeeded", got)
+	}
+
+	// A missed day fails the challenge, after which a new one can start
+	err = s.StartChallenge(ctx, habit.ID, fakeNow().AddDate(0, 0, 4), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "Go").Challenge; got.Days != store.DefaultChallengeDays || got.Outcome != store.ChallengeFailed || got.Day != 2 {
+		t.Errorf("got challenge %+v after missing its first day; want it failed on day 2 of %d", got, store.DefaultChallengeDays)
+	}
+	if err := s.AbandonChallenge(ctx, habit.ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("abandoning a failed challenge: wanted ErrInvalid, got %v", err)
+	}
+	err = s.StartChallenge(ctx, habit.ID, time.Time{}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PerformHabit(ctx, *get(t, s, "Go"), 1); err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 6))
+	err = s.AbandonChallenge(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 9))
+	if got := get(t, s, "Go").Challenge; got.Outcome != store.ChallengeAbandoned || got.Day != 2 || got.Running() {
+		t.Errorf("got challenge %+v after abandoning it on its second day; want it abandoned on day 2", got)
+	}
+	challenges, err := s.Challenges(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []store.Outcome
+	for _, c := range challenges {
+		outcomes = append(outcomes, c.Outcome)
+	}
+	want := []store.Outcome{store.ChallengeAbandoned, store.ChallengeFailed, store.ChallengeSucceeded}
+	if !cmp.Equal(outcomes, want) {
+		t.Errorf("got outcomes %v; want %v", outcomes, want)
+	}
+
+	// Paused days are not due
+	setNow(fakeNow().AddDate(0, 0, 10))
+	err = s.StartChallenge(ctx, habit.ID, time.Time{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.PauseHabit(ctx, habit.ID, fakeNow().AddDate(0, 0, 10), fakeNow().AddDate(0, 0, 11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 12))
+	if got := get(t, s, "Go").Challenge; got.Outcome != store.ChallengeRunning || got.Day != 3 || got.Due != 1 {
+		t.Errorf("got challenge %+v over paused days; want it running with one day due", got)
+	}
+	err = s.DeleteHabit(ctx, habit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Challenges(ctx, habit.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("listing the challenges of a deleted habit: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceChallengeQuit(t *testing.T, s store.HabitStore, setNow func(time.Time)) {
+	ctx := context.Background()
+	err := s.Add(ctx, store.Habit{Name: "sugar", Kind: store.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sugar := get(t, s, "sugar")
+	err = s.StartChallenge(ctx, sugar.ID, time.Time{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 1))
+	if got := get(t, s, "sugar").Challenge; got.Outcome != store.ChallengeRunning || got.Day != 2 || got.Done != 1 || got.Due != 3 {
+		t.Errorf("got challenge %+v a day without relapse; want it running with one day done", got)
+	}
+	if _, err := s.Relapse(ctx, *get(t, s, "sugar")); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "sugar").Challenge; got.Outcome != store.ChallengeFailed {
+		t.Errorf("got challenge %+v after a relapse; want it failed", got)
+	}
+	setNow(fakeNow().AddDate(0, 0, 2))
+	err = s.StartChallenge(ctx, sugar.ID, time.Time{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNow(fakeNow().AddDate(0, 0, 4))
+	if got := get(t, s, "sugar").Challenge; got.Outcome != store.ChallengeSucceeded || got.Done != 2 {
+		t.Errorf("got challenge %+v after staying away for its days; want it succeeded", got)
+	}
+}
+
+func testConformanceChallengeInvalid(t *testing.T, s store.HabitStore, _ func(time.Time)) {
+	ctx := context.Background()
+	habit := addAndGet(t, s, "Go")
+	tests := map[string]struct {
+		start time.Time
+		days  int
+	}{
+		"too long":       {days: 366},
+		"negative days":  {days: -1},
+		"too far back":   {start: fakeNow().AddDate(0, 0, -store.DefaultBackfillDays-1)},
+		"after tomorrow": {start: fakeNow().AddDate(0, 0, 2)},
+		"year 9999":      {start: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for name, tc := range tests {
+		if err := s.StartChallenge(ctx, habit.ID, tc.start, tc.days); !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("%s: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+	err := s.Add(ctx, store.Habit{Name: "run", Schedule: store.Schedule{PerWeek: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartChallenge(ctx, get(t, s, "run").ID, time.Time{}, 0); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("challenge of a habit with a weekly target: wanted ErrInvalid, got %v", err)
+	}
+	err = s.ArchiveHabit(ctx, habit.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartChallenge(ctx, habit.ID, time.Time{}, 0); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("challenge of an archived habit: wanted ErrInvalid, got %v", err)
+	}
+	if err := s.StartChallenge(ctx, 404, time.Time{}, 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("challenge of a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.AbandonChallenge(ctx, 404); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("abandoning the challenge of a missing habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.AbandonChallenge(ctx, habit.ID); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("abandoning without a challenge: wanted ErrInvalid, got %v", err)
+	}
+}
+
+func testConformanceOwnership(t *testing.T, s store.Store, _ func(time.Time)) {
+	ana, err := s.AddUser(context.Background(), "ana@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.AddUser(context.Background(), "bob@example.com", "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	asAna := store.WithUser(context.Background(), ana)
+	asBob := store.WithUser(context.Background(), bob)
+	for _, ctx := range []context.Context{asAna, asBob, context.Background()} {
+		if err := s.Add(ctx, store.Habit{Name: "Go"}); err != nil {
+			t.Fatalf("each user can have their own Go habit: %v", err)
+		}
+	}
+	if err := s.Add(asAna, store.Habit{Name: "piano"}); err != nil {
+		t.Fatal(err)
+	}
+	habits, err := s.AllHabits(asBob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(habits) != 1 || habits[0].Name != "Go" || habits[0].UserID != bob.ID {
+		t.Errorf("Bob sees habits %+v; want only his Go", habits)
+	}
+	piano, err := s.GetHabit(asAna, "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if piano.UserID != ana.ID {
+		t.Errorf("piano is owned by %d; want %d", piano.UserID, ana.ID)
+	}
+	if _, err := s.PerformHabit(asAna, *piano, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetHabit(asBob, "piano"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetHabit(context.Background(), "piano"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting a user's habit without one: wanted ErrNotFound, got %v", err)
+	}
+	history, err := s.History(asBob, *piano)
+	if err != nil || len(history) != 0 {
+		t.Errorf("Bob sees history %+v, %v of Ana's habit; want none", history, err)
+	}
+	if _, err := s.GetHabitByID(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting another user's habit by ID: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteHabit(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleting another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	renamed := *piano
+	renamed.Name = "guitar"
+	if err := s.UpdateHabit(asBob, renamed); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("updating another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.PauseHabit(asBob, piano.ID, fakeNow(), fakeNow()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("pausing another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.ResumeHabit(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("resuming another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.ArchiveHabit(asBob, piano.ID, true); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("archiving another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.LogCheckIn(asBob, piano.ID, fakeNow(), 1); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("logging a check-in of another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if _, err := s.Stats(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("getting the stats of another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.UndoPerform(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("undoing another user's perform: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.StartChallenge(asBob, piano.ID, time.Time{}, 0); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("starting a challenge of another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if _, err := s.Challenges(asBob, piano.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("listing the challenges of another user's habit: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteHabit(asBob, habits[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetHabit(asAna, "Go"); err != nil {
+		t.Errorf("deleting Bob's Go habit deleted Ana's: %v", err)
+	}
+}
+
+func testConformanceSessions(t *testing.T, s store.Store, _ func(time.Time)) {
+	ctx := context.Background()
+	ana := addUser(t, s, "ana@example.com")
+	session, err := s.CreateSession(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Token) < 32 || session.UserID != ana.ID || !session.ExpiresAt.Equal(fakeNow().Add(store.DefaultLifetime)) {
+		t.Errorf("got session %+v", session)
+	}
+	other, err := s.CreateSession(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Token == session.Token {
+		t.Error("two sessions got the same token")
+	}
+	user, err := s.SessionUser(ctx, session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != ana.ID || user.Email != ana.Email {
+		t.Errorf("session belongs to %+v; want %+v", user, ana)
+	}
+	if _, err := s.SessionUser(ctx, "forged"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown token: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteSession(ctx, session.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SessionUser(ctx, session.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("deleted session: wanted ErrNotFound, got %v", err)
+	}
+	if _, err := s.SessionUser(ctx, other.Token); err != nil {
+		t.Errorf("deleting a session ended another one: %v", err)
+	}
+}
+
+func testConformanceSessionExpiry(t *testing.T, s store.Store, setNow func(time.Time)) {
+	ctx := context.Background()
+	ana := addUser(t, s, "ana@example.com")
+	idle, err := s.CreateSession(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := s.CreateSession(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Using a session every six days keeps it going until its lifetime is over
+	for days := 6; days <= 30; days += 6 {
+		setNow(fakeNow().AddDate(0, 0, days))
+		if _, err := s.SessionUser(ctx, busy.Token); err != nil {
+			t.Fatalf("session used every six days is over after %d days: %v", days, err)
+		}
+	}
+	if _, err := s.SessionUser(ctx, idle.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("session unused for a month: wanted ErrNotFound, got %v", err)
+	}
+	setNow(fakeNow().Add(store.DefaultLifetime + time.Minute))
+	if _, err := s.SessionUser(ctx, busy.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("session past its lifetime: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceLogoutEverywhere(t *testing.T, s store.Store, _ func(time.Time)) {
+	ctx := context.Background()
+	ana := addUser(t, s, "ana@example.com")
+	bob := addUser(t, s, "bob@example.com")
+	var anasSessions []*store.Session
+	for i := 0; i < 2; i++ {
+		session, err := s.CreateSession(ctx, ana.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anasSessions = append(anasSessions, session)
+	}
+	bobsSession, err := s.CreateSession(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUserSessions(ctx, ana.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range anasSessions {
+		if _, err := s.SessionUser(ctx, session.Token); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("session after signing out everywhere: wanted ErrNotFound, got %v", err)
+		}
+	}
+	if _, err := s.SessionUser(ctx, bobsSession.Token); err != nil {
+		t.Errorf("signing Ana out everywhere ended Bob's session: %v", err)
+	}
+}
+
+func testConformanceTokens(t *testing.T, s store.Store, setNow func(time.Time)) {
+	ctx := context.Background()
+	ana := addUser(t, s, "ana@example.com")
+	bob := addUser(t, s, "bob@example.com")
+	for _, name := range []string{"", "   ", strings.Repeat("x", 101)} {
+		if _, err := s.CreateToken(ctx, ana.ID, name); !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("creating a token named %q: wanted ErrInvalid, got %v", name, err)
+		}
+	}
+	token, err := s.CreateToken(ctx, ana.ID, " cron job ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token == "" || token.Name != "cron job" || token.UserID != ana.ID {
+		t.Fatalf("got new token %+v; want the secret, trimmed name and Ana as user", token)
+	}
+	if _, err := s.CreateToken(ctx, bob.ID, "bob's"); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := s.Tokens(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != token.ID || tokens[0].Token != "" || !tokens[0].LastUsedAt.IsZero() {
+		t.Fatalf("got tokens of Ana %+v; want only the unused cron job, without its secret", tokens)
+	}
+	used := fakeNow().Add(time.Hour)
+	setNow(used)
+	user, err := s.TokenUser(ctx, token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != ana.ID {
+		t.Errorf("token of Ana signs in user %d", user.ID)
+	}
+	tokens, err = s.Tokens(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokens[0].LastUsedAt.Equal(used) {
+		t.Errorf("token last used at %v; want %v", tokens[0].LastUsedAt, used)
+	}
+	if _, err := s.TokenUser(ctx, "habits_forged"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("using an unknown token: wanted ErrNotFound, got %v", err)
+	}
+}
+
+func testConformanceTokenRevoke(t *testing.T, s store.Store, _ func(time.Time)) {
+	ctx := context.Background()
+	ana := addUser(t, s, "ana@example.com")
+	bob := addUser(t, s, "bob@example.com")
+	token, err := s.CreateToken(ctx, ana.ID, "cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeToken(ctx, bob.ID, token.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Bob revoking the token of Ana: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.RevokeToken(ctx, ana.ID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TokenUser(ctx, token.Token); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("using a revoked token: wanted ErrNotFound, got %v", err)
+	}
+	if err := s.RevokeToken(ctx, ana.ID, token.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("revoking a token twice: wanted ErrNotFound, got %v", err)
+	}
+	tokens, err := s.Tokens(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("got tokens %+v after revoking the only one", tokens)
+	}
+}
+
+// addUser signs up a user with the email
+func addUser(t *testing.T, s store.UserStore, email string) *store.User {
+	t.Helper()
+	user, err := s.AddUser(context.Background(), email, "correct horse")
+	if err != nil {
+		t.Fatalf("got an error signing up: %v", err)
+	}
+	return user
+}
+
+// addAndGet adds a habit with the given name and returns it as stored
+func addAndGet(t *testing.T, s store.HabitStore, name string) *store.Habit {
+	t.Helper()
+	err := s.Add(context.Background(), store.Habit{Name: name})
+	if err != nil {
+		t.Fatalf("got an error adding Habit: %v", err)
+	}
+	return get(t, s, name)
+}
+
+// get returns the stored habit with the given name
+func get(t *testing.T, s store.HabitStore, name string) *store.Habit {
+	t.Helper()
+	habit, err := s.GetHabit(context.Background(), name)
+	if err != nil {
+		t.Fatalf("got an error getting Habit: %v", err)
+	}
+	return habit
+}
+
+// Mocks time.Now method for testing purposes
+func fakeNow() time.Time {
+	return time.Date(2021, 10, 15, 17, 8, 0, 0, time.UTC)
+}
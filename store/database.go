@@ -1,214 +1,1245 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/mattn/go-sqlite3"
-)
-
-//currentTime returns system time
-func currentTime() time.Time {
-	return time.Now()
-}
-
-const (
-	sqlite3Schema = `
-		CREATE TABLE IF NOT EXISTS "habits" (
-	   		"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
-			"name" TEXT NOT NULL,
-			"LastPerformed" DATETIME NOT NULL,
-			"streak" INTEGER
-	);`
-
-	mySqlSchema = `
-	CREATE TABLE IF NOT EXISTS habits (
-  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
-  		name TEXT NOT NULL,
- 		LastPerformed DATETIME NOT NULL,
-  		streak INT NOT NULL
-)
-	`
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
+// HabitStore is implemented by every habit storage backend. Habits are
+// addressed by their ID, which stays the same when they are renamed, and
+// GetHabit looks one up by its name, unique among the habits of a user. All
+// methods respect cancellation of the context and report failures as errors;
+// ErrNotFound, ErrExists and ErrInvalid can be matched with errors.Is.
 type HabitStore interface {
-	LastCheckDays(habit Habit) int
-	Add(habit Habit)
-	AllHabits() ([]Habit, error)
-	PerformHabit(habit Habit, days int) string
-	GetHabit(name string) (*Habit, error)
-	DeleteHabitByName(name string) error
+	Add(ctx context.Context, habit Habit) error
+	AllHabits(ctx context.Context) ([]Habit, error)
+	PerformHabit(ctx context.Context, habit Habit, amount float64) (string, error)
+	Relapse(ctx context.Context, habit Habit) (string, error)
+	GetHabit(ctx context.Context, name string) (*Habit, error)
+	GetHabitByID(ctx context.Context, id int) (*Habit, error)
+	UpdateHabit(ctx context.Context, habit Habit) error
+	DeleteHabit(ctx context.Context, id int) error
+	History(ctx context.Context, habit Habit) ([]CheckIn, error)
+	PauseHabit(ctx context.Context, id int, from, until time.Time) error
+	ResumeHabit(ctx context.Context, id int) error
+	ArchiveHabit(ctx context.Context, id int, archived bool) error
+	LogCheckIn(ctx context.Context, id int, date time.Time, amount float64) error
+	DeleteCheckIn(ctx context.Context, id, checkInID int) error
+	UndoPerform(ctx context.Context, id int) error
+	Stats(ctx context.Context, id int) (*Stats, error)
+	StartChallenge(ctx context.Context, id int, start time.Time, days int) error
+	AbandonChallenge(ctx context.Context, id int) error
+	Challenges(ctx context.Context, id int) ([]Challenge, error)
 }
 
+// DBStore is a Store backed by a SQL database. It tells the time by its
+// Clock, counts calendar days in its Calendar, UTC midnight to midnight
+// unless set, and ends sessions following its Sessions policy. Check-ins
+// can be logged or removed up to BackfillDays back, DefaultBackfillDays
+// unless set.
 type DBStore struct {
-	Habits []Habit
-	Output io.Writer
-	DB     *sql.DB
-	Now    time.Time
+	Habits       []Habit
+	Output       io.Writer
+	DB           *sql.DB
+	Clock        Clock
+	Calendar     Calendar
+	Sessions     SessionPolicy
+	BackfillDays int
+	driver       string
 }
 
-func (s *DBStore) Close() {
-	s.DB.Close()
+// Close closes the connections of the store to its database
+func (s *DBStore) Close() error {
+	return s.DB.Close()
 }
 
-// FromMySQL  is checking for scheme to prepare it, if it doesn't exist
-// and returns a DBStore with connection
-func FromMySQL(source string) (*DBStore, error) {
-	db, err := sql.Open("mysql", source)
-	if err != nil {
-		return nil, err
+// Open returns the habit store of the given kind: "sqlite", "mysql" and
+// "postgres" connect to the database at source, "memory" ignores it and keeps habits
+// in memory until the process exits. Calendar days are counted in calendar.
+func Open(kind, source string, calendar Calendar) (Store, error) {
+	var s *DBStore
+	var err error
+	switch kind {
+	case "sqlite", "sqlite3":
+		s, err = FromSQLite(source)
+	case "mysql":
+		s, err = FromMySQL(source)
+	case "postgres":
+		s, err = FromPostgres(source)
+	case "memory":
+		m := NewMemoryStore()
+		m.Calendar = calendar
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown habit store %q", kind)
 	}
-	stmt, err := db.Prepare(mySqlSchema)
 	if err != nil {
-		return nil, fmt.Errorf("failed to prepare schema with error: %v", err)
+		return nil, err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute schema with error: %v", err)
+	s.Calendar = calendar
+	return s, nil
+}
 
-	}
-	return &DBStore{
-		DB:  db,
-		Now: currentTime(),
-	}, nil
+// FromMySQL  is migrating the scheme to the latest version
+// and returns a DBStore with connection
+func FromMySQL(source string) (*DBStore, error) {
+	return open("mysql", source)
 }
 
-// FromSQLite  is checking for scheme to prepare it, if it doesn't exist
+// FromSQLite  is migrating the scheme to the latest version
 // and returns a DBStore with connection
 func FromSQLite(source string) (*DBStore, error) {
-	db, err := sql.Open("sqlite3", source)
+	return open("sqlite3", source)
+}
+
+// FromPostgres  is migrating the scheme to the latest version
+// and returns a DBStore with connection
+func FromPostgres(source string) (*DBStore, error) {
+	return open("postgres", source)
+}
+
+// open connects to the database with the given driver and migrates it
+func open(driver, source string) (*DBStore, error) {
+	db, err := sql.Open(driver, source)
 	if err != nil {
 		return nil, err
 	}
-	stmt, err := db.Prepare(sqlite3Schema)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare schema with error: %v", err)
-	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
+	_, err = Migrate(db, driver)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute schema with error: %v", err)
+		db.Close()
+		return nil, err
 	}
 	return &DBStore{
-		DB:  db,
-		Now: currentTime(),
+		DB:     db,
+		Clock:  SystemClock{},
+		driver: driver,
 	}, nil
 }
 
+// rebind rewrites the ? placeholders of the query into the placeholder
+// style of the store's driver
+func (s *DBStore) rebind(query string) string {
+	return rebind(s.driver, query)
+}
+
+// rebind rewrites the ? placeholders of the query into the numbered $1, $2
+// ... placeholders Postgres expects, and leaves it untouched for any other
+// driver
+func rebind(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // Print as DBStore method is wrapping Fprintf so that is not needed to specify
 // the default output every time
 func (s DBStore) Print(massage string, params ...interface{}) {
-	if s.Output == nil {
-		fmt.Fprintf(os.Stdout, massage, params...)
-	} else {
-		fmt.Fprintf(s.Output, massage, params...)
-	}
+	notify(s.Output, massage, params...)
 }
 
 // LastCheckDays method checks  for number of days current date and
 func (s DBStore) LastCheckDays(h Habit) int {
-	lastPerformedCalendarDay := h.LastPerformed.Truncate(24 * time.Hour)
-	nowCalendarDay := s.Now.Truncate(24 * time.Hour)
-	return int(nowCalendarDay.Sub(lastPerformedCalendarDay).Hours()) / 24
+	return s.Calendar.daysBetween(h.LastPerformed, s.Clock.Now())
+}
+
+// habitColumns lists the columns of the habits table read by scanHabit
+const habitColumns = `ID, user_id, name, description, kind, LastPerformed, streak, longest_streak, schedule, target, unit, archived_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanHabit reads the habitColumns of a row into a Habit
+func scanHabit(row scanner) (Habit, error) {
+	h := Habit{}
+	var schedule, kind string
+	var archivedAt sql.NullTime
+	err := row.Scan(&h.ID, &h.UserID, &h.Name, &h.Description, &kind, &h.LastPerformed, &h.Streak, &h.LongestStreak, &schedule, &h.Target, &h.Unit, &archivedAt)
+	if err != nil {
+		return h, err
+	}
+	h.Kind = Kind(kind)
+	h.ArchivedAt = archivedAt.Time
+	h.Schedule, err = ParseSchedule(schedule)
+	return h, err
+}
+
+// withStatus works out the fields of the habit that are not stored, as of
+// now, from its check-ins of the current week and its pauses
+func (s *DBStore) withStatus(ctx context.Context, q querier, h *Habit, now time.Time) error {
+	thisWeek, err := s.history(ctx, q, h.ID, s.Calendar.start(s.Calendar.dayOf(now).weekStart()))
+	if err != nil {
+		return err
+	}
+	h.Pauses, err = s.pauses(ctx, q, h.ID)
+	if err != nil {
+		return err
+	}
+	h.LastPerformed = h.LastPerformed.In(s.Calendar.location())
+	h.PausedToday = h.pausedOn(s.Calendar.dayOf(now))
+	challenges, err := s.challenges(ctx, q, *h, now, true)
+	if err != nil {
+		return err
+	}
+	h.Challenge = nil
+	if len(challenges) > 0 {
+		h.Challenge = &challenges[0]
+	}
+	if h.Quitting() {
+		h.Streak = s.Calendar.daysClean(*h, now)
+		if h.Streak > h.LongestStreak {
+			h.LongestStreak = h.Streak
+		}
+	}
+	h.TimesThisWeek = s.Calendar.timesThisWeek(thisWeek, *h, now)
+	h.Progress = s.Calendar.progress(thisWeek, now)
+	h.DueToday = s.Calendar.dueToday(*h, now)
+	return nil
 }
 
-// Add method is adding a habit to the table of Habits
-func (s *DBStore) Add(habit Habit) {
-	_, err := s.DB.Exec(
-		`INSERT INTO habits (name, LastPerformed, streak) VALUES (?,?,?)`,
+// Add method is adding a habit to the table of Habits, owned by the user of
+// the context
+func (s *DBStore) Add(ctx context.Context, habit Habit) error {
+	owner := ownerID(ctx)
+	var count int
+	err := s.DB.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM habits WHERE name=? AND user_id=?`), habit.Name, owner).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing Habit with error: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("failed to add Habit %q: %w", habit.Name, ErrExists)
+	}
+	err = habit.validate()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx,
+		s.rebind(`INSERT INTO habits (user_id, name, description, kind, LastPerformed, streak, schedule, target, unit) VALUES (?,?,?,?,?,?,?,?,?)`),
+		owner,
 		habit.Name,
-		s.Now,
+		habit.Description,
+		string(habit.Kind),
+		s.Clock.Now().UTC(),
 		habit.Streak,
+		habit.Schedule.String(),
+		habit.Target,
+		habit.Unit,
 	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("failed to add Habit %q: %w", habit.Name, ErrExists)
+	}
 	if err != nil {
-		fmt.Printf("execute failed: %v", err)
+		return fmt.Errorf("failed to add Habit with error: %w", err)
 	}
-	s.Print("Good luck with your new '%s' habit. Don't forget to do it again tomorrow.\n", habit.Name)
+	s.Print("%s", AddedMassage(habit))
+	return nil
 }
 
 // GetHabit takes habit name and returns a habit if it finds one
-func (s *DBStore) GetHabit(name string) (*Habit, error) {
-	row := s.DB.QueryRow(`SELECT ID, name, LastPerformed, streak FROM habits WHERE name=?;`, name)
-	h := Habit{}
-	err := row.Scan(&h.ID, &h.Name, &h.LastPerformed, &h.Streak)
+func (s *DBStore) GetHabit(ctx context.Context, name string) (*Habit, error) {
+	row := s.DB.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE name=? AND user_id=?;`), name, ownerID(ctx))
+	h, err := scanHabit(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find Habit %q: %w", name, ErrNotFound)
+	}
+	return s.found(ctx, h, err)
+}
+
+// GetHabitByID returns the habit with the ID if it finds one
+func (s *DBStore) GetHabitByID(ctx context.Context, id int) (*Habit, error) {
+	row := s.DB.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx))
+	h, err := scanHabit(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find Habit %d: %w", id, ErrNotFound)
+	}
+	return s.found(ctx, h, err)
+}
+
+// found returns the habit read by GetHabit or GetHabitByID with the fields
+// that are not stored worked out
+func (s *DBStore) found(ctx context.Context, h Habit, err error) (*Habit, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to find Habit with error: %w", err)
 	}
+	err = s.withStatus(ctx, s.DB, &h, s.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
 	return &h, nil
 }
 
-// DeleteHabitByName deletes a Habit by name from database
-func (s *DBStore) DeleteHabitByName(name string) error {
-	_, err := s.DB.Exec(
-		`DELETE FROM habits WHERE name=?`, name)
+// UpdateHabit changes the name, description, schedule, target and unit of
+// the stored habit with the ID of the given one. Its history is kept and its streak
+// derived from it again under the new schedule and target.
+func (s *DBStore) UpdateHabit(ctx context.Context, habit Habit) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		fmt.Printf("Error deleting habit: %v", err)
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+	stored, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), habit.ID, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to update Habit %q: %w", habit.Name, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM habits WHERE name=? AND user_id=? AND ID<>?`), habit.Name, stored.UserID, habit.ID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing Habit with error: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("failed to rename Habit to %q: %w", habit.Name, ErrExists)
+	}
+	h, err := stored.updated(habit)
+	if err != nil {
+		return err
+	}
+	checkIns, err := s.history(ctx, tx, h.ID, time.Time{})
+	if err != nil {
+		return err
+	}
+	h.Pauses, err = s.pauses(ctx, tx, h.ID)
+	if err != nil {
+		return err
+	}
+	if !h.Quitting() && len(checkIns) > 0 {
+		h.Streak = s.Calendar.Streak(checkIns, h)
+		h.LongestStreak = s.Calendar.LongestStreak(checkIns, h)
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habits set name=?,description=?,schedule=?,target=?,unit=?,streak=?,longest_streak=? WHERE ID=?`),
+		h.Name, h.Description, h.Schedule.String(), h.Target, h.Unit, h.Streak, h.LongestStreak, h.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("failed to rename Habit to %q: %w", habit.Name, ErrExists)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update Habit with error: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteHabit deletes the Habit with the ID, together with its check-in
+// history, pauses and challenges, from database
+func (s *DBStore) DeleteHabit(ctx context.Context, id int) error {
+	owner := ownerID(ctx)
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx,
+		s.rebind(`DELETE FROM habit_events WHERE habit_id IN (SELECT ID FROM habits WHERE ID=? AND user_id=?)`), id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete Habit history with error: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		s.rebind(`DELETE FROM habit_pauses WHERE habit_id IN (SELECT ID FROM habits WHERE ID=? AND user_id=?)`), id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete Habit pauses with error: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		s.rebind(`DELETE FROM habit_challenges WHERE habit_id IN (SELECT ID FROM habits WHERE ID=? AND user_id=?)`), id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete Habit challenges with error: %w", err)
+	}
+	res, err := tx.ExecContext(ctx,
+		s.rebind(`DELETE FROM habits WHERE ID=? AND user_id=?`), id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to delete Habit with error: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete Habit with error: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("failed to delete Habit %d: %w", id, ErrNotFound)
+	}
+	return tx.Commit()
 }
 
-// AllHabits lists all Habits in the database
-func (s *DBStore) AllHabits() ([]Habit, error) {
+// isUniqueViolation reports whether the error of a statement comes from a
+// unique constraint of the database, like the one on the names of habits
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// AllHabits lists all Habits in the database owned by the user of the context
+func (s *DBStore) AllHabits(ctx context.Context) ([]Habit, error) {
 	var allHabits []Habit
-	rows, err := s.DB.Query(`SELECT ID, name, LastPerformed, streak FROM habits`)
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE user_id=? ORDER BY ID`), ownerID(ctx))
 	if err != nil {
-		fmt.Printf("query error: %v\n", err)
+		return nil, fmt.Errorf("failed to query Habits with error: %w", err)
 	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			fmt.Printf("error closing rows: %v\n", err)
-		}
-	}(rows)
-	habit := Habit{}
+	defer rows.Close()
 	for rows.Next() {
-		err := rows.Scan(&habit.ID, &habit.Name, &habit.LastPerformed, &habit.Streak)
+		habit, err := scanHabit(rows)
 		if err != nil {
-			fmt.Printf("scan error: %v\n", err)
+			return nil, fmt.Errorf("failed to scan Habit with error: %w", err)
 		}
 		allHabits = append(allHabits, habit)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list Habits with error: %w", err)
+	}
+	rows.Close()
+	now := s.Clock.Now()
+	for i := range allHabits {
+		err := s.withStatus(ctx, s.DB, &allHabits[i], now)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return allHabits, nil
 }
 
-// Perform changes the last checked date
-func (s *DBStore) Perform(habit Habit) {
-	if s.LastCheckDays(habit) > 1 {
-		habit.Streak = 1
-	} else {
-		habit.Streak++
+// History returns every check-in of the habit, oldest first, and none for
+// habits the user of the context does not own
+func (s *DBStore) History(ctx context.Context, habit Habit) ([]CheckIn, error) {
+	var count int
+	err := s.DB.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM habits WHERE ID=? AND user_id=?`), habit.ID, ownerID(ctx)).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
 	}
-	_, err := s.DB.Exec(`UPDATE habits set LastPerformed=?,streak=? WHERE name=?`, s.Now, habit.Streak, habit.Name)
+	return s.history(ctx, s.DB, habit.ID, time.Time{})
+}
+
+// Stats works out the figures of the habit with the ID from its history
+func (s *DBStore) Stats(ctx context.Context, id int) (*Stats, error) {
+	h, err := s.GetHabitByID(ctx, id)
 	if err != nil {
-		fmt.Printf(" failed to execute last checked date and streak on habit with error: %v\n", err)
+		return nil, err
 	}
+	history, err := s.History(ctx, *h)
+	if err != nil {
+		return nil, err
+	}
+	stats := s.Calendar.stats(history, *h, s.Clock.Now())
+	return &stats, nil
+}
+
+// Perform records a check-in for the habit and derives the streak and
+// last checked date from the recorded history. Quantitative habits are
+// checked in with their whole target.
+func (s *DBStore) Perform(ctx context.Context, habit Habit) error {
+	_, _, err := s.perform(ctx, habit, habit.Target, false)
+	return err
+}
+
+// perform records a check-in of the amount for the habit and returns the
+// days since it was last performed together with the habit as stored
+// afterwards. Both are worked out from the habit as stored, locked until the
+// check-in is recorded, so that requests performing it at the same time
+// don't both count. With once set nothing is recorded for habits without a
+// target that were already performed today.
+func (s *DBStore) perform(ctx context.Context, habit Habit, amount float64, once bool) (int, Habit, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, habit, err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`+s.forUpdate()), habit.ID, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, habit, fmt.Errorf("failed to perform Habit %q: %w", habit.Name, ErrNotFound)
+	}
+	if err != nil {
+		return 0, habit, fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	if h.Archived() {
+		return 0, habit, fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	}
+	now := s.Clock.Now()
+	days := s.Calendar.daysBetween(h.LastPerformed, now)
+	if once && days == 0 && !h.Quantitative() {
+		err = s.withStatus(ctx, tx, &h, now)
+		return days, h, err
+	}
+	amount, err = checkInAmount(h, amount)
+	if err != nil {
+		return days, habit, err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO habit_events (habit_id, performed_at, amount, previous_performed) VALUES (?,?,?,?)`),
+		h.ID, now.UTC(), amount, h.LastPerformed.UTC())
+	if err != nil {
+		return days, habit, fmt.Errorf("failed to record check-in on habit with error: %w", err)
+	}
+	checkIns, err := s.history(ctx, tx, h.ID, time.Time{})
+	if err != nil {
+		return days, habit, err
+	}
+	h.Pauses, err = s.pauses(ctx, tx, h.ID)
+	if err != nil {
+		return days, habit, err
+	}
+	h.LastPerformed = now
+	h.Streak = s.Calendar.Streak(checkIns, h)
+	h.LongestStreak = s.Calendar.LongestStreak(checkIns, h)
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habits set LastPerformed=?,streak=?,longest_streak=? WHERE ID=?`), now.UTC(), h.Streak, h.LongestStreak, h.ID)
+	if err != nil {
+		return days, habit, fmt.Errorf("failed to execute last checked date and streak on habit with error: %w", err)
+	}
+	err = s.withStatus(ctx, tx, &h, now)
+	if err != nil {
+		return days, habit, err
+	}
+	return days, h, tx.Commit()
+}
+
+// forUpdate returns the clause locking the rows a query of a transaction
+// reads until it ends. SQLite has none, as it lets one transaction at a
+// time write to the whole database.
+func (s *DBStore) forUpdate() string {
+	if s.driver == "sqlite3" {
+		return ""
+	}
+	return ` FOR UPDATE`
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// history reads the check-ins of the habit with the given ID, oldest first,
+// leaving out those before since unless it is zero
+func (s *DBStore) history(ctx context.Context, q querier, habitID int, since time.Time) ([]CheckIn, error) {
+	query := `SELECT ID, habit_id, performed_at, amount FROM habit_events WHERE habit_id=?`
+	args := []interface{}{habitID}
+	if !since.IsZero() {
+		query += ` AND performed_at>=?`
+		args = append(args, since.UTC())
+	}
+	rows, err := q.QueryContext(ctx, s.rebind(query+` ORDER BY performed_at, ID`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history with error: %w", err)
+	}
+	defer rows.Close()
+	var checkIns []CheckIn
+	for rows.Next() {
+		c := CheckIn{}
+		err := rows.Scan(&c.ID, &c.HabitID, &c.PerformedAt, &c.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan check-in with error: %w", err)
+		}
+		checkIns = append(checkIns, c)
+	}
+	return checkIns, rows.Err()
 }
 
 // PerformHabit makes a dissection based on days between current time and last checked date and
 //forwards the massage to handler and frontend
-func (s *DBStore) PerformHabit(h Habit, days int) (massage string) {
-	switch {
-	case days == 0:
-		massage = fmt.Sprintf("You already perfromed '%s' habit today. Your current streak is %v days in a row.\n", h.Name, h.Streak)
-		s.Print(massage)
-	case days == 1 && h.Streak > 15:
-		s.Perform(h)
-		massage = fmt.Sprintf("You're currently on a %d-day streak for '%s'. Stick to it!\n", h.Streak+1, h.Name)
-		s.Print(massage)
-	case days == 1:
-		s.Perform(h)
-		massage = fmt.Sprintf("Nice work: you've done the habit '%s' for %v days in a row.\n", h.Name, h.Streak+1)
-		s.Print(massage)
-	case days >= 2:
-		s.Perform(h)
-		massage = fmt.Sprintf("You last did the habit '%s' %d days ago, so you're starting a new streak today. Good luck!\n", h.Name, days)
-		s.Print(massage)
-	}
-	return massage
+func (s *DBStore) PerformHabit(ctx context.Context, h Habit, amount float64) (string, error) {
+	if h.Archived() {
+		return "", fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	}
+	if h.Quitting() {
+		// There is nothing to record for staying away from a habit
+		massage := quitMassage(h, s.LastCheckDays(h))
+		s.Print("%s", massage)
+		return massage, nil
+	}
+	days, performed, err := s.perform(ctx, h, amount, true)
+	if err != nil {
+		return "", err
+	}
+	massage := challengeMassage(performMassage(h, days, amount, performed), h, h.Challenge, performed.Challenge)
+	s.Print("%s", massage)
+	return massage, nil
+}
+
+// Relapse logs a slip on a habit to quit: it records a check-in and starts
+// counting the days since all over again
+func (s *DBStore) Relapse(ctx context.Context, h Habit) (string, error) {
+	if !h.Quitting() {
+		return "", fmt.Errorf("'%s' is not a habit to quit: %w", h.Name, ErrInvalid)
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	stored, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), h.ID, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("failed to log relapse of Habit %q: %w", h.Name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	if stored.Archived() {
+		return "", fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	}
+	now := s.Clock.Now()
+	longest := stored.LongestStreak
+	if days := s.Calendar.daysBetween(stored.LastPerformed, now); days > longest {
+		longest = days
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habits set LastPerformed=?,streak=?,longest_streak=? WHERE ID=?`), now.UTC(), 0, longest, h.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to reset habit with error: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO habit_events (habit_id, performed_at, amount) VALUES (?,?,?)`), h.ID, now.UTC(), 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to record relapse on habit with error: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	massage := relapseMassage(stored, s.Calendar.daysBetween(stored.LastPerformed, now))
+	s.Print("%s", massage)
+	return massage, nil
+}
+
+// pauses reads the pauses of the habit with the given ID, earliest first
+func (s *DBStore) pauses(ctx context.Context, q querier, habitID int) ([]Pause, error) {
+	rows, err := q.QueryContext(ctx, s.rebind(`SELECT ID, habit_id, starts_on, ends_on FROM habit_pauses WHERE habit_id=? ORDER BY starts_on, ID`), habitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pauses with error: %w", err)
+	}
+	defer rows.Close()
+	var pauses []Pause
+	for rows.Next() {
+		p := Pause{}
+		err := rows.Scan(&p.ID, &p.HabitID, &p.From, &p.Until)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pause with error: %w", err)
+		}
+		pauses = append(pauses, p)
+	}
+	return pauses, rows.Err()
+}
+
+// PauseHabit pauses the habit with the ID from one date until another, both
+// included, and derives its streak again now that the days are skipped
+func (s *DBStore) PauseHabit(ctx context.Context, id int, from, until time.Time) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to pause Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	pause, err := newPause(h, from, until)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO habit_pauses (habit_id, starts_on, ends_on) VALUES (?,?,?)`), h.ID, pause.From, pause.Until)
+	if err != nil {
+		return fmt.Errorf("failed to pause Habit with error: %w", err)
+	}
+	err = s.restreak(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResumeHabit ends the pauses of the habit with the ID as of today: the one
+// running ends yesterday and those still to come are dropped
+func (s *DBStore) ResumeHabit(ctx context.Context, id int) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to resume Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	pauses, err := s.pauses(ctx, tx, h.ID)
+	if err != nil {
+		return err
+	}
+	today := s.Calendar.dayOf(s.Clock.Now())
+	for _, p := range pauses {
+		resumed, kept := p.resumed(today)
+		switch {
+		case !kept:
+			_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM habit_pauses WHERE ID=?`), p.ID)
+		case !resumed.Until.Equal(p.Until):
+			_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habit_pauses set ends_on=? WHERE ID=?`), resumed.Until, p.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resume Habit with error: %w", err)
+		}
+	}
+	err = s.restreak(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// challenges reads the challenges of the habit, newest first, with their
+// outcomes worked out as of now; only the latest one when latest is set.
+// The pauses of the habit must be read already.
+func (s *DBStore) challenges(ctx context.Context, q querier, h Habit, now time.Time, latest bool) ([]Challenge, error) {
+	query := `SELECT ID, habit_id, starts_on, days, abandoned_on FROM habit_challenges WHERE habit_id=? ORDER BY ID DESC`
+	if latest {
+		query += ` LIMIT 1`
+	}
+	rows, err := q.QueryContext(ctx, s.rebind(query), h.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query challenges with error: %w", err)
+	}
+	defer rows.Close()
+	var challenges []Challenge
+	for rows.Next() {
+		c := Challenge{}
+		var abandonedOn sql.NullTime
+		err := rows.Scan(&c.ID, &c.HabitID, &c.Start, &c.Days, &abandonedOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan challenge with error: %w", err)
+		}
+		c.AbandonedOn = abandonedOn.Time
+		challenges = append(challenges, c)
+	}
+	err = rows.Err()
+	if err != nil || len(challenges) == 0 {
+		return nil, err
+	}
+	first := dateOf(challenges[0].Start)
+	for _, c := range challenges {
+		if dateOf(c.Start) < first {
+			first = dateOf(c.Start)
+		}
+	}
+	history, err := s.history(ctx, q, h.ID, s.Calendar.start(first))
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range challenges {
+		challenges[i] = s.Calendar.judge(c, h, history, now)
+	}
+	return challenges, nil
+}
+
+// StartChallenge takes on a challenge of the habit with the ID over days from
+// the date of start, today when it is zero or tomorrow for habits added
+// today, and DefaultChallengeDays days when days is 0. It may start up to
+// BackfillDays back, and only once the latest challenge of the habit is over.
+func (s *DBStore) StartChallenge(ctx context.Context, id int, start time.Time, days int) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to start challenge of Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	now := s.Clock.Now()
+	err = s.withStatus(ctx, tx, &h, now)
+	if err != nil {
+		return err
+	}
+	challenge, err := s.Calendar.newChallenge(h, start, days, now, backfillWindow(s.BackfillDays), h.Challenge)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO habit_challenges (habit_id, starts_on, days) VALUES (?,?,?)`), h.ID, challenge.Start, challenge.Days)
+	if err != nil {
+		return fmt.Errorf("failed to start challenge with error: %w", err)
+	}
+	return tx.Commit()
+}
+
+// AbandonChallenge gives up on the running challenge of the habit with the ID
+// as of today
+func (s *DBStore) AbandonChallenge(ctx context.Context, id int) error {
+	h, err := s.GetHabitByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if h.Challenge == nil || !h.Challenge.Running() {
+		return fmt.Errorf("'%s' has no challenge running: %w", h.Name, ErrInvalid)
+	}
+	today := s.Calendar.dayOf(s.Clock.Now())
+	_, err = s.DB.ExecContext(ctx, s.rebind(`UPDATE habit_challenges set abandoned_on=? WHERE ID=?`), today.date(), h.Challenge.ID)
+	if err != nil {
+		return fmt.Errorf("failed to abandon challenge with error: %w", err)
+	}
+	return nil
+}
+
+// Challenges returns every challenge of the habit with the ID, newest first,
+// with their outcomes
+func (s *DBStore) Challenges(ctx context.Context, id int) ([]Challenge, error) {
+	h, err := s.GetHabitByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.challenges(ctx, s.DB, *h, s.Clock.Now(), false)
+}
+
+// restreak derives the streaks and last performance of the habit again from
+// its history and pauses, within the transaction. Without any check-ins left
+// the habit keeps the time it was last performed and starts over.
+func (s *DBStore) restreak(ctx context.Context, tx *sql.Tx, h Habit) error {
+	if h.Quitting() {
+		return nil
+	}
+	checkIns, err := s.history(ctx, tx, h.ID, time.Time{})
+	if err != nil {
+		return err
+	}
+	h.Pauses, err = s.pauses(ctx, tx, h.ID)
+	if err != nil {
+		return err
+	}
+	h.Streak = s.Calendar.Streak(checkIns, h)
+	h.LongestStreak = s.Calendar.LongestStreak(checkIns, h)
+	if len(checkIns) > 0 {
+		h.LastPerformed = checkIns[len(checkIns)-1].PerformedAt
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habits set LastPerformed=?,streak=?,longest_streak=? WHERE ID=?`),
+		h.LastPerformed.UTC(), h.Streak, h.LongestStreak, h.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update streak of Habit with error: %w", err)
+	}
+	return nil
+}
+
+// LogCheckIn records a check-in of the amount for the habit with the ID on
+// the day of the date, which may be up to BackfillDays back, and derives its
+// streaks again from the history. Habits without a target are performed at
+// most once a day.
+func (s *DBStore) LogCheckIn(ctx context.Context, id int, date time.Time, amount float64) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to log check-in of Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	now := s.Clock.Now()
+	d := dateOf(date)
+	err = checkBackfill(h, d, s.Calendar.dayOf(now), backfillWindow(s.BackfillDays))
+	if err != nil {
+		return err
+	}
+	amount, err = checkInAmount(h, amount)
+	if err != nil {
+		return err
+	}
+	at := s.Calendar.backfilledAt(d, now)
+	if !h.Quantitative() {
+		checkIns, err := s.history(ctx, tx, h.ID, s.Calendar.start(d))
+		if err != nil {
+			return err
+		}
+		if s.Calendar.performedOn(checkIns, d) {
+			return fmt.Errorf("'%s' was already performed on %s: %w", h.Name, date.Format(DateLayout), ErrExists)
+		}
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO habit_events (habit_id, performed_at, amount, previous_performed) VALUES (?,?,?,?)`),
+		h.ID, at.UTC(), amount, h.LastPerformed.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record check-in on habit with error: %w", err)
+	}
+	err = s.restreak(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCheckIn removes the check-in with the given ID from the history of
+// the habit with the ID, if it is up to BackfillDays old, and derives its
+// streaks again from what is left
+func (s *DBStore) DeleteCheckIn(ctx context.Context, id, checkInID int) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to delete check-in of Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	var performedAt time.Time
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT performed_at FROM habit_events WHERE ID=? AND habit_id=?`), checkInID, h.ID).Scan(&performedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to delete check-in %d of Habit %q: %w", checkInID, h.Name, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find check-in with error: %w", err)
+	}
+	err = checkBackfill(h, s.Calendar.dayOf(performedAt), s.Calendar.dayOf(s.Clock.Now()), backfillWindow(s.BackfillDays))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM habit_events WHERE ID=?`), checkInID)
+	if err != nil {
+		return fmt.Errorf("failed to delete check-in with error: %w", err)
+	}
+	err = s.restreak(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ArchiveHabit archives the habit with the ID, or restores it when archived
+// is false. Archived habits keep their history and streak.
+func (s *DBStore) ArchiveHabit(ctx context.Context, id int, archived bool) error {
+	owner := ownerID(ctx)
+	var count int
+	err := s.DB.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM habits WHERE ID=? AND user_id=?`), id, owner).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("failed to archive Habit %d: %w", id, ErrNotFound)
+	}
+	var archivedAt interface{}
+	if archived {
+		archivedAt = s.Clock.Now().UTC()
+	}
+	_, err = s.DB.ExecContext(ctx, s.rebind(`UPDATE habits set archived_at=? WHERE ID=? AND user_id=?`), archivedAt, id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to archive Habit with error: %w", err)
+	}
+	return nil
+}
+
+// UndoPerform takes back the latest check-in of the habit with the ID if it
+// was recorded no longer than UndoWindow ago, restoring the habit to how it
+// was before: the check-in leaves the history, the time the habit was last
+// performed goes back and the streaks are derived again
+func (s *DBStore) UndoPerform(ctx context.Context, id int) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	h, err := scanHabit(tx.QueryRowContext(ctx, s.rebind(`SELECT `+habitColumns+` FROM habits WHERE ID=? AND user_id=?`), id, ownerID(ctx)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to undo perform of Habit %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find Habit with error: %w", err)
+	}
+	if h.Quitting() {
+		return fmt.Errorf("relapses of habit to quit '%s' can't be undone: %w", h.Name, ErrInvalid)
+	}
+	var checkInID int
+	var performedAt time.Time
+	var previous sql.NullTime
+	err = tx.QueryRowContext(ctx, s.rebind(`SELECT ID, performed_at, previous_performed FROM habit_events WHERE habit_id=? ORDER BY performed_at DESC, ID DESC LIMIT 1`), h.ID).
+		Scan(&checkInID, &performedAt, &previous)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !undoable(performedAt, s.Clock.Now()) {
+		return fmt.Errorf("nothing to undo for '%s': %w", h.Name, ErrInvalid)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find check-in with error: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM habit_events WHERE ID=?`), checkInID)
+	if err != nil {
+		return fmt.Errorf("failed to delete check-in with error: %w", err)
+	}
+	err = s.restreak(ctx, tx, h)
+	if err != nil {
+		return err
+	}
+	if previous.Valid {
+		_, err = tx.ExecContext(ctx, s.rebind(`UPDATE habits set LastPerformed=? WHERE ID=?`), previous.Time.UTC(), h.ID)
+		if err != nil {
+			return fmt.Errorf("failed to restore last checked date of habit with error: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// userColumns lists the columns of the users table read by scanUser
+const userColumns = `ID, email, password_hash, created_at`
+
+// scanUser reads the userColumns of a row into a User
+func scanUser(row scanner) (*User, error) {
+	u := &User{}
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	return u, err
+}
+
+// AddUser signs up a user with the email and password, keeping only the
+// bcrypt hash of the password
+func (s *DBStore) AddUser(ctx context.Context, email, password string) (*User, error) {
+	user, err := newUser(email, password, s.Clock.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	err = s.DB.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*) FROM users WHERE email=?`), user.Email).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing user with error: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("failed to sign up %q: %w", user.Email, ErrEmailTaken)
+	}
+	_, err = s.DB.ExecContext(ctx, s.rebind(`INSERT INTO users (email, password_hash, created_at) VALUES (?,?,?)`),
+		user.Email, user.PasswordHash, user.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add user with error: %w", err)
+	}
+	// Postgres doesn't report the last insert ID, so read the user back
+	return s.userByEmail(ctx, user.Email)
+}
+
+// Authenticate returns the user with the email if the password is theirs,
+// or ErrWrongPassword
+func (s *DBStore) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	user, err := s.userByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrNotFound) {
+		nobody.checkPassword(password)
+		return nil, ErrWrongPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = user.checkPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser returns the user with the ID
+func (s *DBStore) GetUser(ctx context.Context, id int) (*User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, s.rebind(`SELECT `+userColumns+` FROM users WHERE ID=?`), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user with error: %w", err)
+	}
+	return user, nil
+}
+
+// userByEmail returns the user with the normalized email
+func (s *DBStore) userByEmail(ctx context.Context, email string) (*User, error) {
+	user, err := scanUser(s.DB.QueryRowContext(ctx, s.rebind(`SELECT `+userColumns+` FROM users WHERE email=?`), email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find user %q: %w", email, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user with error: %w", err)
+	}
+	return user, nil
+}
+
+// CreateSession signs the user in with a new session and clears the ones of
+// the user that are over
+func (s *DBStore) CreateSession(ctx context.Context, userID int) (*Session, error) {
+	now := s.Clock.Now().UTC()
+	session, err := s.Sessions.newSession(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.DB.ExecContext(ctx, s.rebind(`DELETE FROM sessions WHERE user_id=? AND (last_seen_at<? OR created_at<?)`),
+		userID, now.Add(-s.Sessions.idleTimeout()), now.Add(-s.Sessions.lifetime()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear expired sessions with error: %w", err)
+	}
+	_, err = s.DB.ExecContext(ctx, s.rebind(`INSERT INTO sessions (token_hash, user_id, created_at, last_seen_at) VALUES (?,?,?,?)`),
+		hashToken(session.Token), userID, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session with error: %w", err)
+	}
+	return session, nil
+}
+
+// SessionUser returns the user signed in with the session token and notes
+// that the session was used. Sessions that are over are deleted.
+func (s *DBStore) SessionUser(ctx context.Context, token string) (*User, error) {
+	hash := hashToken(token)
+	row := s.DB.QueryRowContext(ctx, s.rebind(`SELECT sessions.created_at, sessions.last_seen_at,
+		users.ID, users.email, users.password_hash, users.created_at
+		FROM sessions JOIN users ON users.ID = sessions.user_id WHERE sessions.token_hash=?`), hash)
+	session := Session{}
+	user := &User{}
+	err := row.Scan(&session.CreatedAt, &session.LastSeenAt, &user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find session: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find session with error: %w", err)
+	}
+	now := s.Clock.Now().UTC()
+	if s.Sessions.expired(session, now) {
+		err := s.DeleteSession(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("session is over: %w", ErrNotFound)
+	}
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		_, err = s.DB.ExecContext(ctx, s.rebind(`UPDATE sessions SET last_seen_at=? WHERE token_hash=?`), now, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to touch session with error: %w", err)
+		}
+	}
+	return user, nil
+}
+
+// DeleteSession signs out the session with the token
+func (s *DBStore) DeleteSession(ctx context.Context, token string) error {
+	_, err := s.DB.ExecContext(ctx, s.rebind(`DELETE FROM sessions WHERE token_hash=?`), hashToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to delete session with error: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions signs the user out everywhere
+func (s *DBStore) DeleteUserSessions(ctx context.Context, userID int) error {
+	_, err := s.DB.ExecContext(ctx, s.rebind(`DELETE FROM sessions WHERE user_id=?`), userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sessions with error: %w", err)
+	}
+	return nil
+}
+
+// CreateToken creates an API token of the user with the name, keeping only
+// the hash of its secret
+func (s *DBStore) CreateToken(ctx context.Context, userID int, name string) (*APIToken, error) {
+	token, err := newAPIToken(userID, name, s.Clock.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	hash := hashToken(token.Token)
+	_, err = s.DB.ExecContext(ctx, s.rebind(`INSERT INTO api_tokens (token_hash, user_id, name, created_at) VALUES (?,?,?,?)`),
+		hash, userID, token.Name, token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token with error: %w", err)
+	}
+	// Postgres doesn't report the last insert ID, so read it back
+	err = s.DB.QueryRowContext(ctx, s.rebind(`SELECT ID FROM api_tokens WHERE token_hash=?`), hash).Scan(&token.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token with error: %w", err)
+	}
+	return token, nil
+}
+
+// Tokens returns the API tokens of the user, oldest first, without their
+// secrets
+func (s *DBStore) Tokens(ctx context.Context, userID int) ([]APIToken, error) {
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT ID, user_id, name, created_at, last_used_at
+		FROM api_tokens WHERE user_id=? ORDER BY ID`), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens with error: %w", err)
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		t := APIToken{}
+		var lastUsed sql.NullTime
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt, &lastUsed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token with error: %w", err)
+		}
+		t.LastUsedAt = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tokens with error: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes the API token of the user with the ID
+func (s *DBStore) RevokeToken(ctx context.Context, userID, id int) error {
+	res, err := s.DB.ExecContext(ctx, s.rebind(`DELETE FROM api_tokens WHERE ID=? AND user_id=?`), id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token with error: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke token with error: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("failed to find token %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// TokenUser returns the user of the API token and notes that the token was
+// used
+func (s *DBStore) TokenUser(ctx context.Context, token string) (*User, error) {
+	hash := hashToken(token)
+	row := s.DB.QueryRowContext(ctx, s.rebind(`SELECT api_tokens.last_used_at,
+		users.ID, users.email, users.password_hash, users.created_at
+		FROM api_tokens JOIN users ON users.ID = api_tokens.user_id WHERE api_tokens.token_hash=?`), hash)
+	var lastUsed sql.NullTime
+	user := &User{}
+	err := row.Scan(&lastUsed, &user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find token: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find token with error: %w", err)
+	}
+	now := s.Clock.Now().UTC()
+	if !lastUsed.Valid || now.Sub(lastUsed.Time) > touchInterval {
+		_, err = s.DB.ExecContext(ctx, s.rebind(`UPDATE api_tokens SET last_used_at=? WHERE token_hash=?`), now, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to touch token with error: %w", err)
+		}
+	}
+	return user, nil
 }
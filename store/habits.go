@@ -1,46 +1,212 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-// Habit struct has all habit attributes
+var (
+	// ErrNotFound is returned when the requested habit does not exist
+	ErrNotFound = errors.New("habit not found")
+	// ErrExists is returned when adding a habit whose name is already taken
+	ErrExists = errors.New("habit already exists")
+	// ErrInvalid is returned when a habit or check-in does not make sense,
+	// and is wrapped with an explanation
+	ErrInvalid = errors.New("invalid input")
+)
+
+// maxDescriptionLength is the number of characters a description may have
+const maxDescriptionLength = 500
+
+// Kind tells habits to build apart from habits to quit
+type Kind string
+
+const (
+	// BuildHabit is a habit that is performed to keep its streak going
+	BuildHabit Kind = "build"
+	// QuitHabit is a habit to stay away from: its streak grows by itself
+	// every day and only resets when a relapse is logged
+	QuitHabit Kind = "quit"
+)
+
+// Habit struct has all habit attributes. Habits with a Target are
+// quantitative: amounts measured in Unit are checked in through the day and
+// the day only counts once they add up to the target. For habits to quit,
+// LastPerformed is the time of the last slip and Streak the days since.
+// DueToday, TimesThisWeek and Progress are not stored but worked out by the
+// store, from the schedule and history, whenever a habit is read. UserID is
+// the owner of the habit, 0 for habits kept without an account. Description
+// is an optional note on what the habit is about. Pauses are the ranges of
+// days the habit was or will be paused, and PausedToday tells whether one of
+// them covers today. Archived habits have an ArchivedAt time; they are kept
+// with their history but can't be performed. LongestStreak is the longest
+// streak the habit ever had, derived from its history like Streak.
+// Challenge is the latest challenge taken on, if any, whether running or
+// over, as worked out when the habit is read.
 type Habit struct {
 	ID            int
+	UserID        int
 	Name          string
+	Description   string
+	Kind          Kind
 	LastPerformed time.Time
 	Streak        int
+	LongestStreak int
+	Schedule      Schedule
+	Target        float64
+	Unit          string
+	Pauses        []Pause
+	ArchivedAt    time.Time
+	PausedToday   bool
+	DueToday      bool
+	TimesThisWeek int
+	Progress      float64
+	Challenge     *Challenge
 	Output        io.Writer
 }
 
-//func RunCLI() {
-//	MySQLURL := os.Getenv("MYSQL_URL")
-//	if MySQLURL == "" {
-//		MySQLURL = "tester:secret@tcp(127.0.0.:3306)/habits?parseTime=true"
-//	}
-//	store, err := FromMySQL(MySQLURL)
-//	if err != nil {
-//		fmt.Fprintf(os.Stderr, "opening %q database: %v\n", err, MySQLURL)
-//		os.Exit(1)
-//	}
-//	habitName := strings.Join(os.Args[1:], " ")
-//	if len(os.Args) == 1 {
-//		fmt.Println("You are tracking following habits: ")
-//		for _, habit := range store.AllHabits() {
-//			fmt.Println(habit.Name)
-//		}
-//		return
-//	}
-//	habit, err := store.GetHabit(habitName)
-//	if err != nil {
-//		store.Print("searching for record returned an error:%v", err)
-//	}
-//	if habit == nil {
-//		store.Create(Habit{Name: habitName})
-//		return
-//	}
-//	days := store.LastCheckDays(*habit)
-//	fmt.Println(days)
-//	store.PerformHabit(*habit, days)
-//}
+// Quantitative reports whether the habit is measured against a target amount
+func (h Habit) Quantitative() bool {
+	return h.Target > 0
+}
+
+// Archived reports whether the habit was archived
+func (h Habit) Archived() bool {
+	return !h.ArchivedAt.IsZero()
+}
+
+// Quitting reports whether the habit is one to quit rather than to build
+func (h Habit) Quitting() bool {
+	return h.Kind == QuitHabit
+}
+
+// validate checks that a habit makes sense and fills in its kind
+func (h *Habit) validate() error {
+	if strings.TrimSpace(h.Name) == "" {
+		return fmt.Errorf("habit needs a name: %w", ErrInvalid)
+	}
+	switch h.Kind {
+	case "":
+		h.Kind = BuildHabit
+	case BuildHabit, QuitHabit:
+	default:
+		return fmt.Errorf("unknown kind %q of '%s': %w", h.Kind, h.Name, ErrInvalid)
+	}
+	if utf8.RuneCountInString(h.Description) > maxDescriptionLength {
+		return fmt.Errorf("description of '%s' must not be longer than %d characters: %w", h.Name, maxDescriptionLength, ErrInvalid)
+	}
+	if h.Target < 0 {
+		return fmt.Errorf("target of '%s' must not be negative: %w", h.Name, ErrInvalid)
+	}
+	if h.Quitting() && (h.Target > 0 || !h.Schedule.Daily()) {
+		return fmt.Errorf("habit to quit '%s' can't have a target or schedule: %w", h.Name, ErrInvalid)
+	}
+	return nil
+}
+
+// CheckIn is a single performance of a habit as recorded in the
+// habit_events history table. Amount is 1 for habits without a target.
+// For habits to quit every check-in is a relapse.
+type CheckIn struct {
+	ID          int
+	HabitID     int
+	PerformedAt time.Time
+	Amount      float64
+}
+
+// checkInAmount returns the amount to record when performing the habit
+func checkInAmount(h Habit, amount float64) (float64, error) {
+	if !h.Quantitative() {
+		return 1, nil
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount of '%s' must be more than zero: %w", h.Name, ErrInvalid)
+	}
+	return amount, nil
+}
+
+// performMassage describes the outcome of performing the habit, given the
+// habit before it was performed, the number of days since it was last
+// performed, the amount checked in and the habit as it was stored afterwards
+func performMassage(h Habit, days int, amount float64, performed Habit) (massage string) {
+	unit := h.Schedule.Unit()
+	streak := performed.Streak
+	if h.Quantitative() {
+		switch {
+		case performed.Progress < h.Target:
+			return fmt.Sprintf("Logged %g %s of '%s': that's %g of %g %s today.\n",
+				amount, h.Unit, h.Name, performed.Progress, h.Target, h.Unit)
+		case performed.Progress-amount >= h.Target:
+			return fmt.Sprintf("Logged %g more %s of '%s': that's %g of %g %s today. Your current streak is %v %s in a row.\n",
+				amount, h.Unit, h.Name, performed.Progress, h.Target, h.Unit, streak, unit)
+		}
+	}
+	switch {
+	case days == 0 && !h.Quantitative():
+		massage = fmt.Sprintf("You already perfromed '%s' habit today. Your current streak is %v %s in a row.\n", h.Name, streak, unit)
+	case streak > h.Streak && streak > 16:
+		massage = fmt.Sprintf("You're currently on a %d-%s streak for '%s'. Stick to it!\n", streak, strings.TrimSuffix(unit, "s"), h.Name)
+	case streak > h.Streak:
+		massage = fmt.Sprintf("Nice work: you've done the habit '%s' for %v %s in a row.\n", h.Name, streak, unit)
+	case h.Schedule.Weekly():
+		massage = fmt.Sprintf("Nice work: that's %d of %d times this week for '%s'.\n", performed.TimesThisWeek, h.Schedule.PerWeek, h.Name)
+	case h.Quantitative():
+		massage = fmt.Sprintf("You reached your target for '%s' today, so you're starting a new streak. Good luck!\n", h.Name)
+	default:
+		massage = fmt.Sprintf("You last did the habit '%s' %d days ago, so you're starting a new streak today. Good luck!\n", h.Name, days)
+	}
+	return massage
+}
+
+// AddedMassage wishes luck with the newly added habit
+func AddedMassage(h Habit) string {
+	if h.Quitting() {
+		return fmt.Sprintf("Good luck with quitting '%s'. Every day you stay away counts.\n", h.Name)
+	}
+	return fmt.Sprintf("Good luck with your new '%s' habit. Don't forget to do it again tomorrow.\n", h.Name)
+}
+
+// updated returns the habit with the attributes of changes that can be
+// edited, checking that it stays the same kind of habit
+func (h Habit) updated(changes Habit) (Habit, error) {
+	if changes.Kind != "" && changes.Kind != h.Kind {
+		return h, fmt.Errorf("'%s' can't change from a habit to %s to one to %s: %w", h.Name, h.Kind, changes.Kind, ErrInvalid)
+	}
+	h.Name = changes.Name
+	h.Description = changes.Description
+	h.Schedule = changes.Schedule
+	h.Target = changes.Target
+	h.Unit = changes.Unit
+	return h, h.validate()
+}
+
+// quitMassage describes how long the habit to quit has been kept up, given
+// the number of days since the last slip
+func quitMassage(h Habit, days int) string {
+	if days == 0 {
+		return fmt.Sprintf("Day one of staying away from '%s'. Hang in there!\n", h.Name)
+	}
+	return fmt.Sprintf("You've stayed away from '%s' for %d days. Keep it up!\n", h.Name, days)
+}
+
+// relapseMassage describes a slip on the habit to quit, given the number of
+// days it was kept up before
+func relapseMassage(h Habit, days int) string {
+	if days == 0 {
+		return fmt.Sprintf("You slipped on '%s' again today. Tomorrow is a fresh start.\n", h.Name)
+	}
+	return fmt.Sprintf("You slipped on '%s' after %d days. The count starts over today, you can do it!\n", h.Name, days)
+}
+
+// notify writes the massage to the output, or to stdout when none is set
+func notify(output io.Writer, massage string, params ...interface{}) {
+	if output == nil {
+		output = os.Stdout
+	}
+	fmt.Fprintf(output, massage, params...)
+}
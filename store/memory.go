@@ -0,0 +1,902 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a HabitStore that keeps habits and their check-ins in memory.
+// It is safe for concurrent use and follows the same streak rules as DBStore,
+// which makes it a good fit for tests and for running the server in demo mode.
+// It tells the time by its Clock, counts calendar days in its Calendar, UTC
+// midnight to midnight unless set, and ends sessions following its Sessions
+// policy. Check-ins can be logged or removed up to BackfillDays back,
+// DefaultBackfillDays unless set.
+type MemoryStore struct {
+	Output       io.Writer
+	Clock        Clock
+	Calendar     Calendar
+	Sessions     SessionPolicy
+	BackfillDays int
+
+	mu            sync.Mutex
+	habits        []Habit
+	history       []CheckIn
+	pauses        []Pause
+	challenges    []Challenge
+	users         []User
+	sessions      map[string]Session
+	tokens        []storedToken
+	previous      map[int]time.Time // when a habit was last performed before each check-in, by its ID
+	lastID        int
+	lastCheckInID int
+	lastPauseID   int
+	lastChallenge int
+}
+
+// storedToken is an API token as MemoryStore keeps it, by the hash of its
+// secret
+type storedToken struct {
+	APIToken
+	hash string
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Clock: SystemClock{},
+	}
+}
+
+// LastCheckDays method checks for number of days between current date and
+// the last time the habit was performed
+func (s *MemoryStore) LastCheckDays(h Habit) int {
+	return s.Calendar.daysBetween(h.LastPerformed, s.Clock.Now())
+}
+
+// Add method is adding a habit to the store, owned by the user of the context
+func (s *MemoryStore) Add(ctx context.Context, habit Habit) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	owner := ownerID(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(owner, habit.Name) >= 0 {
+		return fmt.Errorf("failed to add Habit %q: %w", habit.Name, ErrExists)
+	}
+	if err := habit.validate(); err != nil {
+		return err
+	}
+	s.lastID++
+	s.habits = append(s.habits, Habit{
+		ID:            s.lastID,
+		UserID:        owner,
+		Name:          habit.Name,
+		Description:   habit.Description,
+		Kind:          habit.Kind,
+		LastPerformed: s.Clock.Now(),
+		Streak:        habit.Streak,
+		Schedule:      habit.Schedule,
+		Target:        habit.Target,
+		Unit:          habit.Unit,
+	})
+	notify(s.Output, "%s", AddedMassage(habit))
+	return nil
+}
+
+// GetHabit takes habit name and returns a habit if it finds one
+func (s *MemoryStore) GetHabit(ctx context.Context, name string) (*Habit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(ownerID(ctx), name)
+	if i < 0 {
+		return nil, fmt.Errorf("failed to find Habit %q: %w", name, ErrNotFound)
+	}
+	h := s.withStatus(s.habits[i], s.Clock.Now())
+	return &h, nil
+}
+
+// GetHabitByID returns the habit with the ID if it finds one
+func (s *MemoryStore) GetHabitByID(ctx context.Context, id int) (*Habit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return nil, fmt.Errorf("failed to find Habit %d: %w", id, ErrNotFound)
+	}
+	h := s.withStatus(s.habits[i], s.Clock.Now())
+	return &h, nil
+}
+
+// UpdateHabit changes the name, description, schedule, target and unit of
+// the stored habit with the ID of the given one. Its history is kept and its
+// streak derived from it again under the new schedule and target.
+func (s *MemoryStore) UpdateHabit(ctx context.Context, habit Habit) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner := ownerID(ctx)
+	i := s.findID(owner, habit.ID)
+	if i < 0 {
+		return fmt.Errorf("failed to update Habit %q: %w", habit.Name, ErrNotFound)
+	}
+	if j := s.find(owner, habit.Name); j >= 0 && j != i {
+		return fmt.Errorf("failed to rename Habit to %q: %w", habit.Name, ErrExists)
+	}
+	h, err := s.habits[i].updated(habit)
+	if err != nil {
+		return err
+	}
+	h.Pauses = s.pausesOf(h.ID)
+	checkIns := s.historyOf(h.ID)
+	if !h.Quitting() && len(checkIns) > 0 {
+		h.Streak = s.Calendar.Streak(checkIns, h)
+		h.LongestStreak = s.Calendar.LongestStreak(checkIns, h)
+	}
+	s.habits[i] = h
+	return nil
+}
+
+// DeleteHabit deletes the Habit with the ID, together with its check-in
+// history, pauses and challenges
+func (s *MemoryStore) DeleteHabit(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to delete Habit %d: %w", id, ErrNotFound)
+	}
+	s.habits = append(s.habits[:i], s.habits[i+1:]...)
+	history := s.history[:0]
+	for _, c := range s.history {
+		if c.HabitID != id {
+			history = append(history, c)
+		} else {
+			delete(s.previous, c.ID)
+		}
+	}
+	s.history = history
+	pauses := s.pauses[:0]
+	for _, p := range s.pauses {
+		if p.HabitID != id {
+			pauses = append(pauses, p)
+		}
+	}
+	s.pauses = pauses
+	challenges := s.challenges[:0]
+	for _, c := range s.challenges {
+		if c.HabitID != id {
+			challenges = append(challenges, c)
+		}
+	}
+	s.challenges = challenges
+	return nil
+}
+
+// AllHabits lists all Habits in the store owned by the user of the context
+func (s *MemoryStore) AllHabits(ctx context.Context) ([]Habit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	owner := ownerID(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var allHabits []Habit
+	now := s.Clock.Now()
+	for _, h := range s.habits {
+		if h.UserID != owner {
+			continue
+		}
+		allHabits = append(allHabits, s.withStatus(h, now))
+	}
+	return allHabits, nil
+}
+
+// History returns every check-in of the habit, oldest first, and none for
+// habits the user of the context does not own
+func (s *MemoryStore) History(ctx context.Context, habit Habit) ([]CheckIn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findID(ownerID(ctx), habit.ID) < 0 {
+		return nil, nil
+	}
+	return s.historyOf(habit.ID), nil
+}
+
+// Stats works out the figures of the habit with the ID from its history
+func (s *MemoryStore) Stats(ctx context.Context, id int) (*Stats, error) {
+	h, err := s.GetHabitByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.History(ctx, *h)
+	if err != nil {
+		return nil, err
+	}
+	stats := s.Calendar.stats(history, *h, s.Clock.Now())
+	return &stats, nil
+}
+
+// Perform records a check-in for the habit and derives the streak and
+// last checked date from the recorded history. Quantitative habits are
+// checked in with their whole target.
+func (s *MemoryStore) Perform(ctx context.Context, habit Habit) error {
+	_, _, err := s.perform(ctx, habit, habit.Target, false)
+	return err
+}
+
+// perform records a check-in of the amount for the habit and returns the
+// days since it was last performed together with the habit as stored
+// afterwards, both worked out under the lock of the store. With once set
+// nothing is recorded for habits without a target that were already
+// performed today.
+func (s *MemoryStore) perform(ctx context.Context, habit Habit, amount float64, once bool) (int, Habit, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, habit, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), habit.ID)
+	if i < 0 {
+		return 0, habit, fmt.Errorf("failed to perform Habit %q: %w", habit.Name, ErrNotFound)
+	}
+	if s.habits[i].Archived() {
+		return 0, habit, fmt.Errorf("archived habit '%s' can't be performed: %w", s.habits[i].Name, ErrInvalid)
+	}
+	now := s.Clock.Now()
+	days := s.Calendar.daysBetween(s.habits[i].LastPerformed, now)
+	if once && days == 0 && !s.habits[i].Quantitative() {
+		return days, s.withStatus(s.habits[i], now), nil
+	}
+	amount, err := checkInAmount(s.habits[i], amount)
+	if err != nil {
+		return days, habit, err
+	}
+	s.lastCheckInID++
+	s.history = append(s.history, CheckIn{
+		ID:          s.lastCheckInID,
+		HabitID:     habit.ID,
+		PerformedAt: now,
+		Amount:      amount,
+	})
+	s.remember(s.lastCheckInID, s.habits[i].LastPerformed)
+	s.habits[i].LastPerformed = now
+	s.habits[i].Pauses = s.pausesOf(habit.ID)
+	s.habits[i].Streak = s.Calendar.Streak(s.historyOf(habit.ID), s.habits[i])
+	s.habits[i].LongestStreak = s.Calendar.LongestStreak(s.historyOf(habit.ID), s.habits[i])
+	return days, s.withStatus(s.habits[i], now), nil
+}
+
+// PerformHabit performs the habit unless it was already performed today and
+// returns the massage for the handler and frontend
+func (s *MemoryStore) PerformHabit(ctx context.Context, h Habit, amount float64) (string, error) {
+	if h.Archived() {
+		return "", fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	}
+	if h.Quitting() {
+		// There is nothing to record for staying away from a habit
+		massage := quitMassage(h, s.LastCheckDays(h))
+		notify(s.Output, "%s", massage)
+		return massage, nil
+	}
+	days, performed, err := s.perform(ctx, h, amount, true)
+	if err != nil {
+		return "", err
+	}
+	massage := challengeMassage(performMassage(h, days, amount, performed), h, h.Challenge, performed.Challenge)
+	notify(s.Output, "%s", massage)
+	return massage, nil
+}
+
+// Relapse logs a slip on a habit to quit: it records a check-in and starts
+// counting the days since all over again
+func (s *MemoryStore) Relapse(ctx context.Context, h Habit) (string, error) {
+	if !h.Quitting() {
+		return "", fmt.Errorf("'%s' is not a habit to quit: %w", h.Name, ErrInvalid)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	i := s.findID(ownerID(ctx), h.ID)
+	if i < 0 {
+		s.mu.Unlock()
+		return "", fmt.Errorf("failed to log relapse of Habit %q: %w", h.Name, ErrNotFound)
+	}
+	if s.habits[i].Archived() {
+		s.mu.Unlock()
+		return "", fmt.Errorf("archived habit '%s' can't be performed: %w", h.Name, ErrInvalid)
+	}
+	now := s.Clock.Now()
+	days := s.Calendar.daysBetween(s.habits[i].LastPerformed, now)
+	s.lastCheckInID++
+	s.history = append(s.history, CheckIn{
+		ID:          s.lastCheckInID,
+		HabitID:     h.ID,
+		PerformedAt: now,
+		Amount:      1,
+	})
+	if days > s.habits[i].LongestStreak {
+		s.habits[i].LongestStreak = days
+	}
+	s.habits[i].LastPerformed = now
+	s.habits[i].Streak = 0
+	s.mu.Unlock()
+	massage := relapseMassage(h, days)
+	notify(s.Output, "%s", massage)
+	return massage, nil
+}
+
+// withStatus works out the fields of the habit that are not stored, as of now
+func (s *MemoryStore) withStatus(h Habit, now time.Time) Habit {
+	h.Pauses = s.pausesOf(h.ID)
+	h.LastPerformed = h.LastPerformed.In(s.Calendar.location())
+	h.PausedToday = h.pausedOn(s.Calendar.dayOf(now))
+	if h.Quitting() {
+		h.Streak = s.Calendar.daysClean(h, now)
+		if h.Streak > h.LongestStreak {
+			h.LongestStreak = h.Streak
+		}
+	}
+	history := s.historyOf(h.ID)
+	h.Challenge = nil
+	if challenges := s.challengesOf(h, history, now); len(challenges) > 0 {
+		h.Challenge = &challenges[0]
+	}
+	h.TimesThisWeek = s.Calendar.timesThisWeek(history, h, now)
+	h.Progress = s.Calendar.progress(history, now)
+	h.DueToday = s.Calendar.dueToday(h, now)
+	return h
+}
+
+// PauseHabit pauses the habit with the ID from one date until another, both
+// included, and derives its streak again now that the days are skipped
+func (s *MemoryStore) PauseHabit(ctx context.Context, id int, from, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to pause Habit %d: %w", id, ErrNotFound)
+	}
+	pause, err := newPause(s.habits[i], from, until)
+	if err != nil {
+		return err
+	}
+	s.lastPauseID++
+	pause.ID = s.lastPauseID
+	s.pauses = append(s.pauses, pause)
+	s.restreak(i)
+	return nil
+}
+
+// ResumeHabit ends the pauses of the habit with the ID as of today: the one
+// running ends yesterday and those still to come are dropped
+func (s *MemoryStore) ResumeHabit(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to resume Habit %d: %w", id, ErrNotFound)
+	}
+	today := s.Calendar.dayOf(s.Clock.Now())
+	var pauses []Pause
+	for _, p := range s.pauses {
+		if p.HabitID == id {
+			var kept bool
+			p, kept = p.resumed(today)
+			if !kept {
+				continue
+			}
+		}
+		pauses = append(pauses, p)
+	}
+	s.pauses = pauses
+	s.restreak(i)
+	return nil
+}
+
+// restreak derives the streaks and last performance of the habit at the
+// index again from its history and pauses. Without any check-ins left the
+// habit keeps the time it was last performed and starts over.
+func (s *MemoryStore) restreak(i int) {
+	h := s.habits[i]
+	if h.Quitting() {
+		return
+	}
+	checkIns := s.historyOf(h.ID)
+	h.Pauses = s.pausesOf(h.ID)
+	s.habits[i].Streak = s.Calendar.Streak(checkIns, h)
+	s.habits[i].LongestStreak = s.Calendar.LongestStreak(checkIns, h)
+	if len(checkIns) > 0 {
+		s.habits[i].LastPerformed = checkIns[len(checkIns)-1].PerformedAt
+	}
+}
+
+// LogCheckIn records a check-in of the amount for the habit with the ID on
+// the day of the date, which may be up to BackfillDays back, and derives its
+// streaks again from the history. Habits without a target are performed at
+// most once a day.
+func (s *MemoryStore) LogCheckIn(ctx context.Context, id int, date time.Time, amount float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to log check-in of Habit %d: %w", id, ErrNotFound)
+	}
+	h := s.habits[i]
+	now := s.Clock.Now()
+	d := dateOf(date)
+	err := checkBackfill(h, d, s.Calendar.dayOf(now), backfillWindow(s.BackfillDays))
+	if err != nil {
+		return err
+	}
+	amount, err = checkInAmount(h, amount)
+	if err != nil {
+		return err
+	}
+	if !h.Quantitative() && s.Calendar.performedOn(s.historyOf(id), d) {
+		return fmt.Errorf("'%s' was already performed on %s: %w", h.Name, date.Format(DateLayout), ErrExists)
+	}
+	s.lastCheckInID++
+	s.history = append(s.history, CheckIn{
+		ID:          s.lastCheckInID,
+		HabitID:     id,
+		PerformedAt: s.Calendar.backfilledAt(d, now),
+		Amount:      amount,
+	})
+	s.remember(s.lastCheckInID, h.LastPerformed)
+	s.restreak(i)
+	return nil
+}
+
+// DeleteCheckIn removes the check-in with the given ID from the history of
+// the habit with the ID, if it is up to BackfillDays old, and derives its
+// streaks again from what is left
+func (s *MemoryStore) DeleteCheckIn(ctx context.Context, id, checkInID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to delete check-in of Habit %d: %w", id, ErrNotFound)
+	}
+	for j, c := range s.history {
+		if c.ID != checkInID || c.HabitID != id {
+			continue
+		}
+		err := checkBackfill(s.habits[i], s.Calendar.dayOf(c.PerformedAt), s.Calendar.dayOf(s.Clock.Now()), backfillWindow(s.BackfillDays))
+		if err != nil {
+			return err
+		}
+		s.history = append(s.history[:j], s.history[j+1:]...)
+		delete(s.previous, c.ID)
+		s.restreak(i)
+		return nil
+	}
+	return fmt.Errorf("failed to delete check-in %d of Habit %q: %w", checkInID, s.habits[i].Name, ErrNotFound)
+}
+
+// UndoPerform takes back the latest check-in of the habit with the ID if it
+// was recorded no longer than UndoWindow ago, restoring the habit to how it
+// was before: the check-in leaves the history, the time the habit was last
+// performed goes back and the streaks are derived again
+func (s *MemoryStore) UndoPerform(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to undo perform of Habit %d: %w", id, ErrNotFound)
+	}
+	h := s.habits[i]
+	if h.Quitting() {
+		return fmt.Errorf("relapses of habit to quit '%s' can't be undone: %w", h.Name, ErrInvalid)
+	}
+	checkIns := s.historyOf(id)
+	if len(checkIns) == 0 || !undoable(checkIns[len(checkIns)-1].PerformedAt, s.Clock.Now()) {
+		return fmt.Errorf("nothing to undo for '%s': %w", h.Name, ErrInvalid)
+	}
+	last := checkIns[len(checkIns)-1]
+	for j, c := range s.history {
+		if c.ID == last.ID {
+			s.history = append(s.history[:j], s.history[j+1:]...)
+			break
+		}
+	}
+	s.restreak(i)
+	if previous, ok := s.previous[last.ID]; ok {
+		s.habits[i].LastPerformed = previous
+		delete(s.previous, last.ID)
+	}
+	return nil
+}
+
+// StartChallenge takes on a challenge of the habit with the ID over days from
+// the date of start, today when it is zero or tomorrow for habits added
+// today, and DefaultChallengeDays days when days is 0. It may start up to
+// BackfillDays back, and only once the latest challenge of the habit is over.
+func (s *MemoryStore) StartChallenge(ctx context.Context, id int, start time.Time, days int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to start challenge of Habit %d: %w", id, ErrNotFound)
+	}
+	now := s.Clock.Now()
+	h := s.withStatus(s.habits[i], now)
+	challenge, err := s.Calendar.newChallenge(h, start, days, now, backfillWindow(s.BackfillDays), h.Challenge)
+	if err != nil {
+		return err
+	}
+	s.lastChallenge++
+	challenge.ID = s.lastChallenge
+	s.challenges = append(s.challenges, challenge)
+	return nil
+}
+
+// AbandonChallenge gives up on the running challenge of the habit with the ID
+// as of today
+func (s *MemoryStore) AbandonChallenge(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to abandon challenge of Habit %d: %w", id, ErrNotFound)
+	}
+	now := s.Clock.Now()
+	h := s.withStatus(s.habits[i], now)
+	if h.Challenge == nil || !h.Challenge.Running() {
+		return fmt.Errorf("'%s' has no challenge running: %w", h.Name, ErrInvalid)
+	}
+	for j, c := range s.challenges {
+		if c.ID == h.Challenge.ID {
+			s.challenges[j].AbandonedOn = s.Calendar.dayOf(now).date()
+		}
+	}
+	return nil
+}
+
+// Challenges returns every challenge of the habit with the ID, newest first,
+// with their outcomes
+func (s *MemoryStore) Challenges(ctx context.Context, id int) ([]Challenge, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return nil, fmt.Errorf("failed to find Habit %d: %w", id, ErrNotFound)
+	}
+	h := s.habits[i]
+	h.Pauses = s.pausesOf(id)
+	return s.challengesOf(h, s.historyOf(id), s.Clock.Now()), nil
+}
+
+// remember keeps when the habit was last performed before the check-in with
+// the ID, for UndoPerform to restore
+func (s *MemoryStore) remember(checkInID int, previous time.Time) {
+	if s.previous == nil {
+		s.previous = map[int]time.Time{}
+	}
+	s.previous[checkInID] = previous
+}
+
+// ArchiveHabit archives the habit with the ID, or restores it when archived
+// is false. Archived habits keep their history and streak.
+func (s *MemoryStore) ArchiveHabit(ctx context.Context, id int, archived bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.findID(ownerID(ctx), id)
+	if i < 0 {
+		return fmt.Errorf("failed to archive Habit %d: %w", id, ErrNotFound)
+	}
+	s.habits[i].ArchivedAt = time.Time{}
+	if archived {
+		s.habits[i].ArchivedAt = s.Clock.Now()
+	}
+	return nil
+}
+
+// find returns the index of the habit of the owner with the given name, or -1
+func (s *MemoryStore) find(owner int, name string) int {
+	for i, h := range s.habits {
+		if h.UserID == owner && h.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// findID returns the index of the habit of the owner with the given ID, or -1
+func (s *MemoryStore) findID(owner, id int) int {
+	for i, h := range s.habits {
+		if h.UserID == owner && h.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// historyOf returns a copy of the check-ins of the habit, oldest first
+func (s *MemoryStore) historyOf(id int) []CheckIn {
+	var history []CheckIn
+	for _, c := range s.history {
+		if c.HabitID == id {
+			history = append(history, c)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].PerformedAt.Before(history[j].PerformedAt) })
+	return history
+}
+
+// challengesOf returns the challenges of the habit, newest first, with their
+// outcomes worked out from its history as of now. The pauses of the habit
+// must be set already.
+func (s *MemoryStore) challengesOf(h Habit, history []CheckIn, now time.Time) []Challenge {
+	var challenges []Challenge
+	for j := len(s.challenges) - 1; j >= 0; j-- {
+		if s.challenges[j].HabitID == h.ID {
+			challenges = append(challenges, s.Calendar.judge(s.challenges[j], h, history, now))
+		}
+	}
+	return challenges
+}
+
+// pausesOf returns a copy of the pauses of the habit, earliest first
+func (s *MemoryStore) pausesOf(id int) []Pause {
+	var pauses []Pause
+	for _, p := range s.pauses {
+		if p.HabitID == id {
+			pauses = append(pauses, p)
+		}
+	}
+	sort.SliceStable(pauses, func(i, j int) bool { return pauses[i].From.Before(pauses[j].From) })
+	return pauses
+}
+
+// AddUser signs up a user with the email and password, keeping only the
+// bcrypt hash of the password
+func (s *MemoryStore) AddUser(ctx context.Context, email, password string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := newUser(email, password, s.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return nil, fmt.Errorf("failed to sign up %q: %w", user.Email, ErrEmailTaken)
+		}
+	}
+	user.ID = len(s.users) + 1
+	s.users = append(s.users, user)
+	return &user, nil
+}
+
+// Authenticate returns the user with the email if the password is theirs,
+// or ErrWrongPassword
+func (s *MemoryStore) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	email = normalizeEmail(email)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email != email {
+			continue
+		}
+		if err := u.checkPassword(password); err != nil {
+			return nil, err
+		}
+		return &u, nil
+	}
+	nobody.checkPassword(password)
+	return nil, ErrWrongPassword
+}
+
+// GetUser returns the user with the ID
+func (s *MemoryStore) GetUser(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.users) {
+		return nil, fmt.Errorf("failed to find user %d: %w", id, ErrNotFound)
+	}
+	user := s.users[id-1]
+	return &user, nil
+}
+
+// CreateSession signs the user in with a new session and clears the ones of
+// the user that are over
+func (s *MemoryStore) CreateSession(ctx context.Context, userID int) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := s.Clock.Now()
+	session, err := s.Sessions.newSession(userID, now)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, stored := range s.sessions {
+		if stored.UserID == userID && s.Sessions.expired(stored, now) {
+			delete(s.sessions, hash)
+		}
+	}
+	if s.sessions == nil {
+		s.sessions = map[string]Session{}
+	}
+	stored := *session
+	stored.Token = ""
+	s.sessions[hashToken(session.Token)] = stored
+	return session, nil
+}
+
+// SessionUser returns the user signed in with the session token and notes
+// that the session was used. Sessions that are over are deleted.
+func (s *MemoryStore) SessionUser(ctx context.Context, token string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hash := hashToken(token)
+	now := s.Clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[hash]
+	if !ok || session.UserID < 1 || session.UserID > len(s.users) {
+		return nil, fmt.Errorf("failed to find session: %w", ErrNotFound)
+	}
+	if s.Sessions.expired(session, now) {
+		delete(s.sessions, hash)
+		return nil, fmt.Errorf("session is over: %w", ErrNotFound)
+	}
+	session.LastSeenAt = now
+	s.sessions[hash] = session
+	user := s.users[session.UserID-1]
+	return &user, nil
+}
+
+// DeleteSession signs out the session with the token
+func (s *MemoryStore) DeleteSession(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, hashToken(token))
+	return nil
+}
+
+// DeleteUserSessions signs the user out everywhere
+func (s *MemoryStore) DeleteUserSessions(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, hash)
+		}
+	}
+	return nil
+}
+
+// CreateToken creates an API token of the user with the name, keeping only
+// the hash of its secret
+func (s *MemoryStore) CreateToken(ctx context.Context, userID int, name string) (*APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	token, err := newAPIToken(userID, name, s.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = len(s.tokens) + 1
+	stored := storedToken{APIToken: *token, hash: hashToken(token.Token)}
+	stored.Token = ""
+	s.tokens = append(s.tokens, stored)
+	return token, nil
+}
+
+// Tokens returns the API tokens of the user that were not revoked, oldest
+// first, without their secrets
+func (s *MemoryStore) Tokens(ctx context.Context, userID int) ([]APIToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []APIToken{}
+	for _, t := range s.tokens {
+		if t.UserID == userID && t.hash != "" {
+			tokens = append(tokens, t.APIToken)
+		}
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes the API token of the user with the ID
+func (s *MemoryStore) RevokeToken(ctx context.Context, userID, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.tokens) || s.tokens[id-1].UserID != userID || s.tokens[id-1].hash == "" {
+		return fmt.Errorf("failed to find token %d: %w", id, ErrNotFound)
+	}
+	s.tokens[id-1].hash = ""
+	return nil
+}
+
+// TokenUser returns the user of the API token and notes that the token was
+// used
+func (s *MemoryStore) TokenUser(ctx context.Context, token string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	hash := hashToken(token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tokens {
+		if t.hash != hash || t.UserID < 1 || t.UserID > len(s.users) {
+			continue
+		}
+		s.tokens[i].LastUsedAt = s.Clock.Now()
+		user := s.users[t.UserID-1]
+		return &user, nil
+	}
+	return nil, fmt.Errorf("failed to find token: %w", ErrNotFound)
+}
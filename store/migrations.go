@@ -0,0 +1,757 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	sqlite3VersionSchema = `
+		CREATE TABLE IF NOT EXISTS "schema_version" (
+			"version" INTEGER PRIMARY KEY,
+			"description" TEXT NOT NULL,
+			"applied_at" DATETIME NOT NULL
+	);`
+
+	mySqlVersionSchema = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+  		version INT PRIMARY KEY NOT NULL,
+  		description TEXT NOT NULL,
+  		applied_at DATETIME NOT NULL
+)
+	`
+
+	postgresVersionSchema = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INT PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+)
+	`
+)
+
+// migration is a single versioned step of the schema. up holds the
+// statements for every supported driver, and data, if set, runs after them
+// inside the same transaction to move existing rows along.
+type migration struct {
+	version     int
+	description string
+	up          map[string][]string
+	data        func(tx *sql.Tx, driver string) error
+}
+
+// migrations lists every schema change in the order they are applied. The
+// first steps use IF NOT EXISTS so that databases created before versioning
+// was introduced are adopted instead of failing. Never edit a released
+// migration; append a new one instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create habits table",
+		up: map[string][]string{
+			"sqlite3": {`
+		CREATE TABLE IF NOT EXISTS "habits" (
+	   		"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"name" TEXT NOT NULL,
+			"LastPerformed" DATETIME NOT NULL,
+			"streak" INTEGER
+	);`},
+			"mysql": {`
+	CREATE TABLE IF NOT EXISTS habits (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		name TEXT NOT NULL,
+ 		LastPerformed DATETIME NOT NULL,
+  		streak INT NOT NULL
+)
+	`},
+			"postgres": {`
+	CREATE TABLE IF NOT EXISTS habits (
+		ID SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		LastPerformed TIMESTAMP NOT NULL,
+		streak INT NOT NULL
+)
+	`},
+		},
+	},
+	{
+		version:     2,
+		description: "create habit_events table",
+		up: map[string][]string{
+			"sqlite3": {`
+		CREATE TABLE IF NOT EXISTS "habit_events" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"habit_id" INTEGER NOT NULL,
+			"performed_at" DATETIME NOT NULL
+	);`},
+			"mysql": {`
+	CREATE TABLE IF NOT EXISTS habit_events (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		habit_id INT NOT NULL,
+  		performed_at DATETIME NOT NULL,
+  		INDEX habit_events_habit_id (habit_id)
+)
+	`},
+			"postgres": {`
+	CREATE TABLE IF NOT EXISTS habit_events (
+		ID SERIAL PRIMARY KEY,
+		habit_id INT NOT NULL,
+		performed_at TIMESTAMP NOT NULL
+)
+	`, `CREATE INDEX IF NOT EXISTS habit_events_habit_id ON habit_events (habit_id)`},
+		},
+	},
+	{
+		version:     3,
+		description: "backfill habit_events from legacy streaks",
+		data:        backfillHistory,
+	},
+	{
+		version:     4,
+		description: "add schedule to habits",
+		up: map[string][]string{
+			"sqlite3":  {`ALTER TABLE "habits" ADD COLUMN "schedule" TEXT NOT NULL DEFAULT 'daily'`},
+			"mysql":    {`ALTER TABLE habits ADD COLUMN schedule VARCHAR(64) NOT NULL DEFAULT 'daily'`},
+			"postgres": {`ALTER TABLE habits ADD COLUMN schedule TEXT NOT NULL DEFAULT 'daily'`},
+		},
+	},
+	{
+		version:     5,
+		description: "add targets to habits and amounts to habit_events",
+		up: map[string][]string{
+			"sqlite3": {
+				`ALTER TABLE "habits" ADD COLUMN "target" REAL NOT NULL DEFAULT 0`,
+				`ALTER TABLE "habits" ADD COLUMN "unit" TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE "habit_events" ADD COLUMN "amount" REAL NOT NULL DEFAULT 1`,
+			},
+			"mysql": {
+				`ALTER TABLE habits ADD COLUMN target DOUBLE NOT NULL DEFAULT 0`,
+				`ALTER TABLE habits ADD COLUMN unit VARCHAR(32) NOT NULL DEFAULT ''`,
+				`ALTER TABLE habit_events ADD COLUMN amount DOUBLE NOT NULL DEFAULT 1`,
+			},
+			"postgres": {
+				`ALTER TABLE habits ADD COLUMN target DOUBLE PRECISION NOT NULL DEFAULT 0`,
+				`ALTER TABLE habits ADD COLUMN unit TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE habit_events ADD COLUMN amount DOUBLE PRECISION NOT NULL DEFAULT 1`,
+			},
+		},
+	},
+	{
+		version:     6,
+		description: "add kind to habits",
+		up: map[string][]string{
+			"sqlite3":  {`ALTER TABLE "habits" ADD COLUMN "kind" TEXT NOT NULL DEFAULT 'build'`},
+			"mysql":    {`ALTER TABLE habits ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'build'`},
+			"postgres": {`ALTER TABLE habits ADD COLUMN kind TEXT NOT NULL DEFAULT 'build'`},
+		},
+	},
+	{
+		version:     7,
+		description: "create users table and add owners to habits",
+		up: map[string][]string{
+			"sqlite3": {`
+		CREATE TABLE "users" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"email" TEXT NOT NULL UNIQUE,
+			"password_hash" TEXT NOT NULL,
+			"created_at" DATETIME NOT NULL
+	);`,
+				`ALTER TABLE "habits" ADD COLUMN "user_id" INTEGER NOT NULL DEFAULT 0`,
+				`CREATE INDEX habits_user_id ON habits (user_id)`,
+			},
+			"mysql": {`
+	CREATE TABLE users (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		email VARCHAR(255) NOT NULL UNIQUE,
+  		password_hash VARCHAR(255) NOT NULL,
+  		created_at DATETIME NOT NULL
+)
+	`,
+				`ALTER TABLE habits ADD COLUMN user_id INT NOT NULL DEFAULT 0`,
+				`CREATE INDEX habits_user_id ON habits (user_id)`,
+			},
+			"postgres": {`
+	CREATE TABLE users (
+		ID SERIAL PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+)
+	`,
+				`ALTER TABLE habits ADD COLUMN user_id INT NOT NULL DEFAULT 0`,
+				`CREATE INDEX habits_user_id ON habits (user_id)`,
+			},
+		},
+	},
+	{
+		version:     8,
+		description: "create sessions table",
+		up: map[string][]string{
+			"sqlite3": {`
+		CREATE TABLE "sessions" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"token_hash" TEXT NOT NULL UNIQUE,
+			"user_id" INTEGER NOT NULL,
+			"created_at" DATETIME NOT NULL,
+			"last_seen_at" DATETIME NOT NULL
+	);`,
+				`CREATE INDEX sessions_user_id ON sessions (user_id)`,
+			},
+			"mysql": {`
+	CREATE TABLE sessions (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		token_hash CHAR(64) NOT NULL UNIQUE,
+  		user_id INT NOT NULL,
+  		created_at DATETIME NOT NULL,
+  		last_seen_at DATETIME NOT NULL,
+  		INDEX sessions_user_id (user_id)
+)
+	`},
+			"postgres": {`
+	CREATE TABLE sessions (
+		ID SERIAL PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id INT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_seen_at TIMESTAMP NOT NULL
+)
+	`,
+				`CREATE INDEX sessions_user_id ON sessions (user_id)`,
+			},
+		},
+	},
+	{
+		version:     9,
+		description: "create api_tokens table",
+		up: map[string][]string{
+			"sqlite3": {`
+		CREATE TABLE "api_tokens" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"token_hash" TEXT NOT NULL UNIQUE,
+			"user_id" INTEGER NOT NULL,
+			"name" TEXT NOT NULL,
+			"created_at" DATETIME NOT NULL,
+			"last_used_at" DATETIME
+	);`,
+				`CREATE INDEX api_tokens_user_id ON api_tokens (user_id)`,
+			},
+			"mysql": {`
+	CREATE TABLE api_tokens (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		token_hash CHAR(64) NOT NULL UNIQUE,
+  		user_id INT NOT NULL,
+  		name VARCHAR(255) NOT NULL,
+  		created_at DATETIME NOT NULL,
+  		last_used_at DATETIME NULL,
+  		INDEX api_tokens_user_id (user_id)
+)
+	`},
+			"postgres": {`
+	CREATE TABLE api_tokens (
+		ID SERIAL PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id INT NOT NULL,
+		name TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP
+)
+	`,
+				`CREATE INDEX api_tokens_user_id ON api_tokens (user_id)`,
+			},
+		},
+	},
+	{
+		version:     10,
+		description: "rename habits sharing the name of another habit of their user",
+		data:        renameDuplicateHabits,
+	},
+	{
+		version:     11,
+		description: "make habit names unique per user",
+		up: map[string][]string{
+			"sqlite3": {`CREATE UNIQUE INDEX habits_user_id_name ON habits (user_id, name)`},
+			"mysql": {
+				`ALTER TABLE habits MODIFY name VARCHAR(255) NOT NULL`,
+				`CREATE UNIQUE INDEX habits_user_id_name ON habits (user_id, name)`,
+			},
+			"postgres": {`CREATE UNIQUE INDEX habits_user_id_name ON habits (user_id, name)`},
+		},
+	},
+	{
+		version:     12,
+		description: "add description to habits",
+		up: map[string][]string{
+			"sqlite3":  {`ALTER TABLE "habits" ADD COLUMN "description" TEXT NOT NULL DEFAULT ''`},
+			"mysql":    {`ALTER TABLE habits ADD COLUMN description VARCHAR(2000) NOT NULL DEFAULT ''`},
+			"postgres": {`ALTER TABLE habits ADD COLUMN description TEXT NOT NULL DEFAULT ''`},
+		},
+	},
+	{
+		version:     13,
+		description: "add archived_at to habits and create habit_pauses table",
+		up: map[string][]string{
+			"sqlite3": {
+				`ALTER TABLE "habits" ADD COLUMN "archived_at" DATETIME`,
+				`
+		CREATE TABLE "habit_pauses" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"habit_id" INTEGER NOT NULL,
+			"starts_on" DATE NOT NULL,
+			"ends_on" DATE NOT NULL
+	);`,
+				`CREATE INDEX habit_pauses_habit_id ON habit_pauses (habit_id)`,
+			},
+			"mysql": {
+				`ALTER TABLE habits ADD COLUMN archived_at DATETIME NULL`,
+				`
+	CREATE TABLE habit_pauses (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		habit_id INT NOT NULL,
+  		starts_on DATE NOT NULL,
+  		ends_on DATE NOT NULL,
+  		INDEX habit_pauses_habit_id (habit_id)
+)
+	`,
+			},
+			"postgres": {
+				`ALTER TABLE habits ADD COLUMN archived_at TIMESTAMP`,
+				`
+	CREATE TABLE habit_pauses (
+		ID SERIAL PRIMARY KEY,
+		habit_id INT NOT NULL,
+		starts_on DATE NOT NULL,
+		ends_on DATE NOT NULL
+)
+	`,
+				`CREATE INDEX habit_pauses_habit_id ON habit_pauses (habit_id)`,
+			},
+		},
+	},
+	{
+		version:     14,
+		description: "add longest_streak to habits",
+		up: map[string][]string{
+			"sqlite3":  {`ALTER TABLE "habits" ADD COLUMN "longest_streak" INTEGER NOT NULL DEFAULT 0`},
+			"mysql":    {`ALTER TABLE habits ADD COLUMN longest_streak INT NOT NULL DEFAULT 0`},
+			"postgres": {`ALTER TABLE habits ADD COLUMN longest_streak INT NOT NULL DEFAULT 0`},
+		},
+		data: backfillLongestStreaks,
+	},
+	{
+		version:     15,
+		description: "add previous_performed to habit_events",
+		up: map[string][]string{
+			"sqlite3":  {`ALTER TABLE "habit_events" ADD COLUMN "previous_performed" DATETIME`},
+			"mysql":    {`ALTER TABLE habit_events ADD COLUMN previous_performed DATETIME NULL`},
+			"postgres": {`ALTER TABLE habit_events ADD COLUMN previous_performed TIMESTAMP`},
+		},
+	},
+	{
+		version:     16,
+		description: "create habit_challenges table",
+		up: map[string][]string{
+			"sqlite3": {
+				`
+		CREATE TABLE "habit_challenges" (
+			"ID" INTEGER PRIMARY KEY AUTOINCREMENT,
+			"habit_id" INTEGER NOT NULL,
+			"starts_on" DATE NOT NULL,
+			"days" INTEGER NOT NULL,
+			"abandoned_on" DATE
+	);`,
+				`CREATE INDEX habit_challenges_habit_id ON habit_challenges (habit_id)`,
+			},
+			"mysql": {
+				`
+	CREATE TABLE habit_challenges (
+  		ID INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+  		habit_id INT NOT NULL,
+  		starts_on DATE NOT NULL,
+  		days INT NOT NULL,
+  		abandoned_on DATE NULL,
+  		INDEX habit_challenges_habit_id (habit_id)
+)
+	`,
+			},
+			"postgres": {
+				`
+	CREATE TABLE habit_challenges (
+		ID SERIAL PRIMARY KEY,
+		habit_id INT NOT NULL,
+		starts_on DATE NOT NULL,
+		days INT NOT NULL,
+		abandoned_on DATE
+)
+	`,
+				`CREATE INDEX habit_challenges_habit_id ON habit_challenges (habit_id)`,
+			},
+		},
+	},
+	{
+		version:     17,
+		description: "fill longest_streak of habits left without one",
+		data:        fillLongestStreaks,
+	},
+}
+
+// Migrate brings the database up to the latest schema version, applying
+// every pending migration in order, and returns the resulting version. It
+// holds an advisory lock on MySQL and PostgreSQL while migrating, so that
+// servers starting together wait for each other instead of applying the
+// same migration twice.
+func Migrate(db *sql.DB, driver string) (int, error) {
+	versionSchema, ok := map[string]string{
+		"sqlite3":  sqlite3VersionSchema,
+		"mysql":    mySqlVersionSchema,
+		"postgres": postgresVersionSchema,
+	}[driver]
+	if !ok {
+		return 0, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	unlock, err := lockMigrations(context.Background(), db, driver)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock the database for migrating with error: %w", err)
+	}
+	defer unlock()
+	_, err = db.Exec(versionSchema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schema_version table with error: %w", err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		err := m.apply(db, driver)
+		if err != nil {
+			return version, fmt.Errorf("failed to apply migration %d (%s) with error: %w", m.version, m.description, err)
+		}
+		version = m.version
+	}
+	return version, nil
+}
+
+// SchemaVersion returns the latest migration version applied to the database
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version with error: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// migrationLock names the advisory lock held while migrating
+const migrationLock = "habits_migrate"
+
+// lockMigrations takes the migration lock of the database, waiting for
+// whoever holds it, and returns the function that releases it. Advisory
+// locks belong to a session, so the lock is taken and released on a
+// connection of its own. SQLite locks the database file on every write
+// and needs no lock.
+func lockMigrations(ctx context.Context, db *sql.DB, driver string) (func(), error) {
+	if driver == "sqlite3" {
+		return func() {}, nil
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlock := `SELECT pg_advisory_unlock(hashtext($1))`
+	if driver == "mysql" {
+		unlock = `SELECT RELEASE_LOCK(?)`
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, -1)`, migrationLock).Scan(&locked)
+		if err == nil && locked.Int64 != 1 {
+			err = fmt.Errorf("GET_LOCK(%q) did not return 1", migrationLock)
+		}
+	} else {
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext($1))`, migrationLock)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, unlock, migrationLock)
+		conn.Close()
+	}, nil
+}
+
+// apply runs the migration and records its version in a single transaction.
+// MySQL commits every schema change on its own, so a migration that failed
+// halfway stays half applied there; applying it again skips the tables,
+// columns and indexes it already created.
+func (m migration) apply(db *sql.DB, driver string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range m.up[driver] {
+		_, err := tx.Exec(stmt)
+		if err != nil && !(driver == "mysql" && alreadyApplied(err)) {
+			return err
+		}
+	}
+	if m.data != nil {
+		err := m.data(tx, driver)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(rebind(driver, `INSERT INTO schema_version (version, description, applied_at) VALUES (?,?,?)`),
+		m.version, m.description, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// alreadyApplied reports whether the error of a MySQL schema change comes
+// from the table, column or index it creates being there already
+func alreadyApplied(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case 1050, 1060, 1061:
+		// Table exists, duplicate column name, duplicate key name
+		return true
+	}
+	return false
+}
+
+// backfillHistory gives habits created before check-ins were recorded one
+// check-in per day of their stored streak, ending on LastPerformed, so that
+// streaks derived from the history match what users saw before.
+func backfillHistory(tx *sql.Tx, driver string) error {
+	rows, err := tx.Query(`SELECT ID, LastPerformed, streak FROM habits
+		WHERE streak > 0 AND ID NOT IN (SELECT habit_id FROM habit_events)`)
+	if err != nil {
+		return err
+	}
+	var legacy []Habit
+	for rows.Next() {
+		h := Habit{}
+		err := rows.Scan(&h.ID, &h.LastPerformed, &h.Streak)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, h := range legacy {
+		for day := h.Streak - 1; day >= 0; day-- {
+			_, err := tx.Exec(rebind(driver, `INSERT INTO habit_events (habit_id, performed_at) VALUES (?,?)`),
+				h.ID, h.LastPerformed.AddDate(0, 0, -day))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameDuplicateHabits gives every habit but the oldest of a user sharing
+// a name its ID in brackets after the name, like "read (12)", so that names
+// can be made unique without losing any habit or its history
+func renameDuplicateHabits(tx *sql.Tx, driver string) error {
+	rows, err := tx.Query(`SELECT user_id, name FROM habits GROUP BY user_id, name HAVING COUNT(*) > 1`)
+	if err != nil {
+		return err
+	}
+	var duplicates []Habit
+	for rows.Next() {
+		h := Habit{}
+		err := rows.Scan(&h.UserID, &h.Name)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, d := range duplicates {
+		rows, err := tx.Query(rebind(driver, `SELECT ID, name FROM habits WHERE user_id=? AND name=? ORDER BY ID`), d.UserID, d.Name)
+		if err != nil {
+			return err
+		}
+		var habits []Habit
+		for rows.Next() {
+			h := Habit{}
+			err := rows.Scan(&h.ID, &h.Name)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			habits = append(habits, h)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, h := range habits[1:] {
+			_, err := tx.Exec(rebind(driver, `UPDATE habits SET name=? WHERE ID=?`), fmt.Sprintf("%s (%d)", h.Name, h.ID), h.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillLongestStreaks derives the longest streak of every habit from its
+// history and pauses, counting calendar days in UTC. Habits to quit get the
+// most days between two relapses, and never less than their stored streak.
+func backfillLongestStreaks(tx *sql.Tx, driver string) error {
+	rows, err := tx.Query(`SELECT ID, kind, schedule, target, streak FROM habits`)
+	if err != nil {
+		return err
+	}
+	var habits []Habit
+	for rows.Next() {
+		h := Habit{}
+		var kind, schedule string
+		err := rows.Scan(&h.ID, &kind, &schedule, &h.Target, &h.Streak)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		h.Kind = Kind(kind)
+		h.Schedule, err = ParseSchedule(schedule)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		habits = append(habits, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s := &DBStore{driver: driver}
+	ctx := context.Background()
+	for _, h := range habits {
+		checkIns, err := s.history(ctx, tx, h.ID, time.Time{})
+		if err != nil {
+			return err
+		}
+		h.Pauses, err = s.pauses(ctx, tx, h.ID)
+		if err != nil {
+			return err
+		}
+		longest := Calendar{}.LongestStreak(checkIns, h)
+		if h.Quitting() {
+			longest = Calendar{}.longestClean(checkIns)
+		}
+		if h.Streak > longest {
+			longest = h.Streak
+		}
+		_, err = tx.Exec(rebind(driver, `UPDATE habits SET longest_streak=? WHERE ID=?`), longest, h.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillLongestStreaks stores the longest streak of the habits still without
+// one, which databases that added the longest_streak column without working
+// it out are left with. Build habits get their longest run of consecutive
+// UTC days with a check-in, habits to quit the most days between two
+// relapses, and none less than their stored streak. Performing or changing
+// a habit derives it again with the calendar and schedule of the store.
+func fillLongestStreaks(tx *sql.Tx, driver string) error {
+	rows, err := tx.Query(`SELECT ID, kind, streak FROM habits WHERE longest_streak = 0`)
+	if err != nil {
+		return err
+	}
+	var habits []Habit
+	for rows.Next() {
+		h := Habit{}
+		var kind string
+		err := rows.Scan(&h.ID, &kind, &h.Streak)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		h.Kind = Kind(kind)
+		habits = append(habits, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, h := range habits {
+		days, err := checkInDays(tx, driver, h.ID)
+		if err != nil {
+			return err
+		}
+		longest, run := 0, 0
+		for i, d := range days {
+			switch {
+			case h.Kind == QuitHabit && i > 0:
+				run = int(d - days[i-1])
+			case h.Kind == QuitHabit:
+				run = 0
+			case i > 0 && d == days[i-1]:
+				continue
+			case i > 0 && d == days[i-1]+1:
+				run++
+			default:
+				run = 1
+			}
+			if run > longest {
+				longest = run
+			}
+		}
+		if h.Streak > longest {
+			longest = h.Streak
+		}
+		if longest == 0 {
+			continue
+		}
+		_, err = tx.Exec(rebind(driver, `UPDATE habits SET longest_streak=? WHERE ID=?`), longest, h.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInDays returns the UTC days, counted from the Unix epoch, of the
+// check-ins of the habit with the ID, oldest first
+func checkInDays(tx *sql.Tx, driver string, habitID int) ([]int64, error) {
+	rows, err := tx.Query(rebind(driver, `SELECT performed_at FROM habit_events WHERE habit_id=? ORDER BY performed_at`), habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var days []int64
+	for rows.Next() {
+		var performedAt time.Time
+		err := rows.Scan(&performedAt)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, performedAt.Unix()/(24*60*60))
+	}
+	return days, rows.Err()
+}
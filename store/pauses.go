@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pause is a range of calendar days, From to Until inclusive, on which a
+// habit is not expected: paused days neither count for its streak nor break
+// it. Only the dates of From and Until matter.
+type Pause struct {
+	ID      int
+	HabitID int
+	From    time.Time
+	Until   time.Time
+}
+
+// dateOf returns the calendar day of the date of t, whatever its timezone
+func dateOf(t time.Time) day {
+	y, m, d := t.Date()
+	return day(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+}
+
+// date returns the calendar day as a date at midnight UTC
+func (d day) date() time.Time {
+	return time.Unix(int64(d)*24*60*60, 0).UTC()
+}
+
+// newPause returns the pause of the habit from one date until another,
+// checking that it makes sense
+func newPause(h Habit, from, until time.Time) (Pause, error) {
+	if h.Quitting() {
+		return Pause{}, fmt.Errorf("habit to quit '%s' can't be paused: %w", h.Name, ErrInvalid)
+	}
+	if dateOf(until) < dateOf(from) {
+		return Pause{}, fmt.Errorf("pause of '%s' must not end before it starts: %w", h.Name, ErrInvalid)
+	}
+	return Pause{HabitID: h.ID, From: dateOf(from).date(), Until: dateOf(until).date()}, nil
+}
+
+// pausedOn reports whether the habit is paused on the calendar day
+func (h Habit) pausedOn(d day) bool {
+	for _, p := range h.Pauses {
+		if dateOf(p.From) <= d && d <= dateOf(p.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+// pausedIn reports whether the habit is paused on any day of the week
+// starting on the given day
+func (h Habit) pausedIn(week day) bool {
+	for d := week; d < week+7; d++ {
+		if h.pausedOn(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// resumed returns the pause ended the day before today, and false when it
+// starts today or later and is dropped altogether
+func (p Pause) resumed(today day) (Pause, bool) {
+	if dateOf(p.From) >= today {
+		return p, false
+	}
+	if dateOf(p.Until) >= today {
+		p.Until = (today - 1).date()
+	}
+	return p, true
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a habit is expected to be performed. The zero
+// Schedule is daily; Weekdays restricts the habit to specific days of the
+// week and PerWeek asks for a number of performances on any days of the week.
+type Schedule struct {
+	Weekdays []time.Weekday
+	PerWeek  int
+}
+
+// weekdayNames are the short names used in the text form of a schedule,
+// in the order a week runs, starting on Monday
+var weekdayNames = []struct {
+	name    string
+	weekday time.Weekday
+}{
+	{"mon", time.Monday},
+	{"tue", time.Tuesday},
+	{"wed", time.Wednesday},
+	{"thu", time.Thursday},
+	{"fri", time.Friday},
+	{"sat", time.Saturday},
+	{"sun", time.Sunday},
+}
+
+// ParseSchedule parses the text form of a schedule as produced by
+// Schedule.String: "daily", a list of weekdays such as "mon,wed,fri", or a
+// weekly target such as "3/week"
+func ParseSchedule(text string) (Schedule, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" || text == "daily" {
+		return Schedule{}, nil
+	}
+	if times := strings.TrimSuffix(text, "/week"); times != text {
+		perWeek, err := strconv.Atoi(times)
+		if err != nil || perWeek < 1 || perWeek > 7 {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: weekly target must be between 1 and 7: %w", text, ErrInvalid)
+		}
+		return Schedule{PerWeek: perWeek}, nil
+	}
+	var s Schedule
+	for _, name := range strings.Split(text, ",") {
+		weekday, ok := parseWeekday(strings.TrimSpace(name))
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid schedule %q: unknown weekday %q: %w", text, name, ErrInvalid)
+		}
+		s.Weekdays = append(s.Weekdays, weekday)
+	}
+	return NewWeekdaySchedule(s.Weekdays...), nil
+}
+
+// NewWeekdaySchedule returns a schedule for the given days of the week,
+// ignoring duplicates. Without any days the schedule is daily.
+func NewWeekdaySchedule(weekdays ...time.Weekday) Schedule {
+	var s Schedule
+	for _, wd := range weekdayNames {
+		for _, weekday := range weekdays {
+			if weekday == wd.weekday {
+				s.Weekdays = append(s.Weekdays, weekday)
+				break
+			}
+		}
+	}
+	return s
+}
+
+// parseWeekday accepts short or full, case-insensitive, weekday names
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for _, wd := range weekdayNames {
+		if name == wd.name || name == strings.ToLower(wd.weekday.String()) {
+			return wd.weekday, true
+		}
+	}
+	return 0, false
+}
+
+// String returns the text form of the schedule, as stored in the database
+func (s Schedule) String() string {
+	if s.PerWeek > 0 {
+		return fmt.Sprintf("%d/week", s.PerWeek)
+	}
+	if len(s.Weekdays) == 0 {
+		return "daily"
+	}
+	var names []string
+	for _, wd := range weekdayNames {
+		if s.On(wd.weekday) {
+			names = append(names, wd.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Daily reports whether the habit is expected every day
+func (s Schedule) Daily() bool {
+	return s.PerWeek == 0 && len(s.Weekdays) == 0
+}
+
+// Weekly reports whether the habit has a weekly target instead of fixed days
+func (s Schedule) Weekly() bool {
+	return s.PerWeek > 0
+}
+
+// On reports whether the habit is scheduled on the given day of the week.
+// Habits with a weekly target may be performed on any day.
+func (s Schedule) On(weekday time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range s.Weekdays {
+		if wd == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Unit names what the streak of a habit with this schedule counts
+func (s Schedule) Unit() string {
+	if s.Weekly() {
+		return "weeks"
+	}
+	return "days"
+}
@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miloszizic/habits/store"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tcs := []struct {
+		text string
+		want store.Schedule
+		form string
+	}{
+		{"", store.Schedule{}, "daily"},
+		{"daily", store.Schedule{}, "daily"},
+		{"3/week", store.Schedule{PerWeek: 3}, "3/week"},
+		{"fri, Mon,wed", store.Schedule{Weekdays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}}, "mon,wed,fri"},
+		{"sunday,saturday", store.Schedule{Weekdays: []time.Weekday{time.Saturday, time.Sunday}}, "sat,sun"},
+	}
+	for _, tc := range tcs {
+		got, err := store.ParseSchedule(tc.text)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) err = %v; want nil", tc.text, err)
+			continue
+		}
+		if !cmp.Equal(tc.want, got) {
+			t.Errorf("ParseSchedule(%q): %s", tc.text, cmp.Diff(tc.want, got))
+		}
+		if got.String() != tc.form {
+			t.Errorf("ParseSchedule(%q).String() = %q; want %q", tc.text, got.String(), tc.form)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalidSchedules(t *testing.T) {
+	for _, text := range []string{"0/week", "8/week", "x/week", "mon,someday", "weekly"} {
+		_, err := store.ParseSchedule(text)
+		if !errors.Is(err, store.ErrInvalid) {
+			t.Errorf("ParseSchedule(%q) err = %v; want ErrInvalid", text, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultIdleTimeout ends sessions that were not used for a week
+	DefaultIdleTimeout = 7 * 24 * time.Hour
+	// DefaultLifetime ends sessions a month after signing in, used or not
+	DefaultLifetime = 30 * 24 * time.Hour
+	// touchInterval limits how often using a session is written down
+	touchInterval = time.Minute
+)
+
+// Session is a signed-in browser of a user. The store keeps only a hash of
+// the token, which is known just once, when the session is created.
+type Session struct {
+	Token      string
+	UserID     int
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// SessionPolicy tells how long sessions last: they end after IdleTimeout
+// without being used and after Lifetime in any case. Zero durations stand
+// for DefaultIdleTimeout and DefaultLifetime.
+type SessionPolicy struct {
+	IdleTimeout time.Duration
+	Lifetime    time.Duration
+}
+
+// SessionStore keeps the sessions of signed-in users. ErrNotFound is returned
+// for sessions that do not exist or are over.
+type SessionStore interface {
+	CreateSession(ctx context.Context, userID int) (*Session, error)
+	SessionUser(ctx context.Context, token string) (*User, error)
+	DeleteSession(ctx context.Context, token string) error
+	DeleteUserSessions(ctx context.Context, userID int) error
+}
+
+// idleTimeout returns how long a session may go unused
+func (p SessionPolicy) idleTimeout() time.Duration {
+	if p.IdleTimeout <= 0 {
+		return DefaultIdleTimeout
+	}
+	return p.IdleTimeout
+}
+
+// lifetime returns how long a session lasts at most
+func (p SessionPolicy) lifetime() time.Duration {
+	if p.Lifetime <= 0 {
+		return DefaultLifetime
+	}
+	return p.Lifetime
+}
+
+// expired reports whether the session is over at now
+func (p SessionPolicy) expired(s Session, now time.Time) bool {
+	return now.Sub(s.LastSeenAt) > p.idleTimeout() || now.Sub(s.CreatedAt) > p.lifetime()
+}
+
+// newSession returns a session of the user with a fresh random token
+func (p SessionPolicy) newSession(userID int, now time.Time) (*Session, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session token with error: %w", err)
+	}
+	return &Session{
+		Token:      base64.RawURLEncoding.EncodeToString(b),
+		UserID:     userID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(p.lifetime()),
+	}, nil
+}
+
+// hashToken returns the hash of a session token kept in place of the token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
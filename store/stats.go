@@ -0,0 +1,192 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+// StatsWindows are the numbers of days, ending today, over which Stats
+// works out completion rates
+var StatsWindows = []int{7, 30, 90, 365}
+
+// Stats are figures about a habit worked out from its history as of today.
+// CheckIns counts every check-in, or relapse for habits to quit, and Total
+// adds up their amounts. PerWeek is the average number of days a week the
+// habit was performed on. Completion rates and the weekly average cover the
+// days since the habit was first performed, or added when it never was.
+// Year is the activity of every day from the Monday of the week a year ago
+// to today, oldest first.
+type Stats struct {
+	Streak        int
+	LongestStreak int
+	CheckIns      int
+	Total         float64
+	PerWeek       float64
+	Completion    []Completion
+	Year          []Activity
+}
+
+// yearWeeks is how many weeks before the running one Stats.Year goes back
+const yearWeeks = 52
+
+// Activity is what was checked in for a habit on the calendar day of Date,
+// which is at midnight UTC. Performed tells whether the day counted for the
+// streak, or for habits to quit whether a relapse was logged on it.
+type Activity struct {
+	Date      time.Time
+	CheckIns  int
+	Amount    float64
+	Performed bool
+	Paused    bool
+}
+
+// Completion is how many of the days due in the last Days days the habit was
+// performed on. For habits with a weekly target it counts the times asked
+// for by the target instead, and for habits to quit the days without a
+// relapse. Today only counts once done, and paused days don't count at all.
+type Completion struct {
+	Days int
+	Due  int
+	Done int
+}
+
+// Rate returns the share of the due days that were done, from 0 to 1, or 0
+// when none were due
+func (c Completion) Rate() float64 {
+	if c.Due == 0 {
+		return 0
+	}
+	return float64(c.Done) / float64(c.Due)
+}
+
+// Percent returns the rate as a whole percentage
+func (c Completion) Percent() int {
+	return int(math.Round(c.Rate() * 100))
+}
+
+// stats works out the figures of the habit from its check-in history ordered
+// oldest first, as of the calendar day of now
+func (c Calendar) stats(history []CheckIn, h Habit, now time.Time) Stats {
+	stats := Stats{
+		Streak:        h.Streak,
+		LongestStreak: h.LongestStreak,
+		CheckIns:      len(history),
+	}
+	for _, checkIn := range history {
+		stats.Total += checkIn.Amount
+	}
+	today := c.dayOf(now)
+	start := c.dayOf(h.LastPerformed)
+	if len(history) > 0 && c.dayOf(history[0].PerformedAt) < start {
+		start = c.dayOf(history[0].PerformedAt)
+	}
+	if start > today {
+		start = today
+	}
+	performed := c.performedDays(history, h)
+	days := 0
+	for d := range performed {
+		if start <= d && d <= today {
+			days++
+		}
+	}
+	stats.PerWeek = float64(days) / math.Max(float64(today-start+1)/7, 1)
+	for _, window := range StatsWindows {
+		from := today - day(window) + 1
+		if from < start {
+			from = start
+		}
+		completion := Completion{Days: window}
+		switch {
+		case h.Quitting():
+			completion.Due, completion.Done = cleanDays(performed, from, today)
+		case h.Schedule.Weekly():
+			completion.Due, completion.Done = weeklyCompletion(performed, h, from, today)
+		default:
+			completion.Due, completion.Done = dailyCompletion(performed, h, from, today)
+		}
+		stats.Completion = append(stats.Completion, completion)
+	}
+	stats.Year = c.year(history, h, performed, today)
+	return stats
+}
+
+// year returns the activity of the habit on every day from the Monday of the
+// week a year before today to today
+func (c Calendar) year(history []CheckIn, h Habit, performed map[day]bool, today day) []Activity {
+	first := today.weekStart() - yearWeeks*7
+	year := make([]Activity, 0, today-first+1)
+	for d := first; d <= today; d++ {
+		year = append(year, Activity{Date: d.date(), Performed: performed[d], Paused: h.pausedOn(d)})
+	}
+	for _, checkIn := range history {
+		if d := c.dayOf(checkIn.PerformedAt); first <= d && d <= today {
+			year[d-first].CheckIns++
+			year[d-first].Amount += checkIn.Amount
+		}
+	}
+	return year
+}
+
+// dailyCompletion counts the scheduled days from one day to another and the
+// ones the habit was performed on
+func dailyCompletion(performed map[day]bool, h Habit, from, today day) (due, done int) {
+	for d := from; d <= today; d++ {
+		switch {
+		case !h.Schedule.On(d.Weekday()):
+		case performed[d]:
+			due++
+			done++
+		case h.pausedOn(d), d == today:
+			// Neither due nor missed
+		default:
+			due++
+		}
+	}
+	return due, done
+}
+
+// weeklyCompletion counts the times the weekly target of the habit asked for
+// in the weeks from one day to another and the ones it was performed. The
+// running week only counts the times already performed. A week starting
+// before from only counts its days from then on, and asks for its share of
+// the target, rounded up.
+func weeklyCompletion(performed map[day]bool, h Habit, from, today day) (due, done int) {
+	perWeek := h.Schedule.PerWeek
+	for week := from.weekStart(); week <= today; week += 7 {
+		first, target := week, perWeek
+		if first < from {
+			first = from
+			target = (perWeek*int(week+7-from) + 6) / 7
+		}
+		times := 0
+		for d := first; d < week+7; d++ {
+			if performed[d] {
+				times++
+			}
+		}
+		if times > target {
+			times = target
+		}
+		done += times
+		switch {
+		case week == today.weekStart(), h.pausedIn(week) && times < target:
+			due += times
+		default:
+			due += target
+		}
+	}
+	return due, done
+}
+
+// cleanDays counts the days from one day to another and the ones without a
+// relapse of a habit to quit
+func cleanDays(relapsed map[day]bool, from, today day) (due, done int) {
+	for d := from; d <= today; d++ {
+		due++
+		if !relapsed[d] {
+			done++
+		}
+	}
+	return due, done
+}
@@ -0,0 +1,196 @@
+package store
+
+import "time"
+
+// performedDays returns the days on which the habit was performed: any day
+// with a check-in, or for quantitative habits, the days on which the amounts
+// checked in added up to the target
+func (cal Calendar) performedDays(history []CheckIn, h Habit) map[day]bool {
+	amounts := make(map[day]float64)
+	for _, c := range history {
+		amounts[cal.dayOf(c.PerformedAt)] += c.Amount
+	}
+	performed := make(map[day]bool)
+	for d, amount := range amounts {
+		if !h.Quantitative() || amount >= h.Target {
+			performed[d] = true
+		}
+	}
+	return performed
+}
+
+// progress adds up the amounts checked in on the day of now
+func (cal Calendar) progress(history []CheckIn, now time.Time) float64 {
+	today := cal.dayOf(now)
+	amount := 0.0
+	for _, c := range history {
+		if cal.dayOf(c.PerformedAt) == today {
+			amount += c.Amount
+		}
+	}
+	return amount
+}
+
+// Streak derives the streak of the habit from its check-in history ordered
+// oldest first, as of the calendar day of the latest check-in.
+//
+// For daily habits it counts the consecutive calendar days on which the habit
+// was performed. Habits scheduled on specific weekdays only break their
+// streak on a missed scheduled day, while performances on other days still
+// count. Habits with a weekly target count consecutive weeks in which the
+// target was met; the week of the latest check-in only counts once met, but
+// does not break the streak while it is still running short. Quantitative
+// habits only count the days on which their target amount was reached, and
+// like weeks, the last day does not break the streak while running short.
+// Days on which the habit is paused, and weeks running short with paused
+// days, are skipped without breaking the streak.
+func (c Calendar) Streak(history []CheckIn, h Habit) int {
+	if len(history) == 0 {
+		return 0
+	}
+	schedule := h.Schedule
+	performed := c.performedDays(history, h)
+	first := c.dayOf(history[0].PerformedAt)
+	last := c.dayOf(history[len(history)-1].PerformedAt)
+	if schedule.Weekly() {
+		return weeklyStreak(performed, h, first, last)
+	}
+	if !performed[last] {
+		// Still short of the target on the last day, which may be today
+		last--
+	}
+	streak := 0
+	for d := last; d >= first; d-- {
+		switch {
+		case performed[d]:
+			streak++
+		case h.pausedOn(d):
+			// Neither counts nor breaks the streak
+		case schedule.On(d.Weekday()):
+			return streak
+		}
+	}
+	return streak
+}
+
+// weeklyStreak counts the consecutive weeks, ending with the week of the
+// last day, in which the habit was performed on at least as many days as its
+// weekly target
+func weeklyStreak(performed map[day]bool, h Habit, first, last day) int {
+	perWeek := h.Schedule.PerWeek
+	streak := 0
+	week := last.weekStart()
+	if timesIn(performed, week) >= perWeek {
+		streak++
+	}
+	for week -= 7; week >= first.weekStart(); week -= 7 {
+		if timesIn(performed, week) < perWeek {
+			if h.pausedIn(week) {
+				continue
+			}
+			break
+		}
+		streak++
+	}
+	return streak
+}
+
+// LongestStreak derives the longest streak the habit ever had from its
+// check-in history ordered oldest first, following the same rules as Streak
+func (c Calendar) LongestStreak(history []CheckIn, h Habit) int {
+	if len(history) == 0 {
+		return 0
+	}
+	performed := c.performedDays(history, h)
+	first := c.dayOf(history[0].PerformedAt)
+	last := c.dayOf(history[len(history)-1].PerformedAt)
+	longest, streak := 0, 0
+	if h.Schedule.Weekly() {
+		for week := first.weekStart(); week <= last.weekStart(); week += 7 {
+			switch {
+			case timesIn(performed, week) >= h.Schedule.PerWeek:
+				streak++
+			case h.pausedIn(week):
+			default:
+				streak = 0
+			}
+			if streak > longest {
+				longest = streak
+			}
+		}
+		return longest
+	}
+	for d := first; d <= last; d++ {
+		switch {
+		case performed[d]:
+			streak++
+		case h.pausedOn(d):
+		case h.Schedule.On(d.Weekday()):
+			streak = 0
+		}
+		if streak > longest {
+			longest = streak
+		}
+	}
+	return longest
+}
+
+// longestClean returns the most days a habit to quit went without a slip
+// between the relapses of its history ordered oldest first
+func (c Calendar) longestClean(history []CheckIn) int {
+	longest := 0
+	for i := 1; i < len(history); i++ {
+		if days := c.daysBetween(history[i-1].PerformedAt, history[i].PerformedAt); days > longest {
+			longest = days
+		}
+	}
+	return longest
+}
+
+// timesIn counts the performed days of the week starting on the given day
+func timesIn(performed map[day]bool, week day) int {
+	times := 0
+	for d := week; d < week+7; d++ {
+		if performed[d] {
+			times++
+		}
+	}
+	return times
+}
+
+// timesThisWeek counts the days of the week of now on which the habit was
+// performed, given its check-ins of that week
+func (c Calendar) timesThisWeek(checkIns []CheckIn, h Habit, now time.Time) int {
+	week := c.dayOf(now).weekStart()
+	times := 0
+	for d := range c.performedDays(checkIns, h) {
+		if d >= week && d < week+7 {
+			times++
+		}
+	}
+	return times
+}
+
+// daysClean returns the streak of a habit to quit: the days from its last
+// slip, or from when it was added, to the day of now
+func (c Calendar) daysClean(h Habit, now time.Time) int {
+	return c.daysBetween(h.LastPerformed, now)
+}
+
+// dueToday reports whether the habit still has to be performed on the day
+// of now, given its progress and how many times it was performed that week
+func (c Calendar) dueToday(h Habit, now time.Time) bool {
+	if h.Quitting() || h.Archived() || h.pausedOn(c.dayOf(now)) {
+		return false
+	}
+	if h.Quantitative() && h.Progress >= h.Target {
+		return false
+	}
+	if !h.Quantitative() && c.daysBetween(h.LastPerformed, now) == 0 {
+		return false
+	}
+	if h.Schedule.Weekly() {
+		return h.TimesThisWeek < h.Schedule.PerWeek
+	}
+	return h.Schedule.On(c.dayOf(now).Weekday())
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenPrefix starts every API token, so that leaked tokens are easy to
+	// recognize
+	tokenPrefix = "habits_"
+	// maxTokenNameLength is the most characters the name of a token may have
+	maxTokenNameLength = 100
+)
+
+// APIToken is a personal token that scripts use in place of a password to
+// act on behalf of its user through the API. The store keeps only a hash of
+// the token, which is known just once, when the token is created.
+// LastUsedAt is zero until the token is first used.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Token      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// TokenStore keeps the API tokens of users. ErrNotFound is returned for
+// tokens that do not exist or were revoked, and ErrInvalid for tokens
+// without a proper name.
+type TokenStore interface {
+	CreateToken(ctx context.Context, userID int, name string) (*APIToken, error)
+	Tokens(ctx context.Context, userID int) ([]APIToken, error)
+	RevokeToken(ctx context.Context, userID, id int) error
+	TokenUser(ctx context.Context, token string) (*User, error)
+}
+
+// newAPIToken returns a token of the user with the name and a fresh random
+// secret
+func newAPIToken(userID int, name string, now time.Time) (*APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("token needs a name: %w", ErrInvalid)
+	}
+	if len([]rune(name)) > maxTokenNameLength {
+		return nil, fmt.Errorf("token name must have at most %d characters: %w", maxTokenNameLength, ErrInvalid)
+	}
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token with error: %w", err)
+	}
+	return &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Token:     tokenPrefix + base64.RawURLEncoding.EncodeToString(b),
+		CreatedAt: now,
+	}, nil
+}
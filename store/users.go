@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrEmailTaken is returned when signing up with the email of an existing user
+	ErrEmailTaken = errors.New("email is already signed up")
+	// ErrWrongPassword is returned when the email or the password of a login is wrong
+	ErrWrongPassword = errors.New("email or password is wrong")
+)
+
+// minPasswordLength is the fewest characters a password may have. bcrypt
+// caps it at 72 bytes.
+const minPasswordLength = 8
+
+// nobody stands in for the user of an unknown email when logging in, so
+// that checking their password takes as long as for a user who exists and
+// the time of a failed login doesn't tell whether the email is signed up.
+// Its hash, at bcrypt's default cost, matches no password anyone would try.
+var nobody = User{PasswordHash: "$2a$10$.x5hA85U.qo08N6oW1MzIeNWjG9y6iJoj1FcsuRXaQwfOHguGmocq"}
+
+// User is a person with an account, who owns habits
+type User struct {
+	ID           int
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+// UserStore keeps the accounts of users. ErrEmailTaken, ErrWrongPassword,
+// ErrNotFound and ErrInvalid can be matched with errors.Is.
+type UserStore interface {
+	AddUser(ctx context.Context, email, password string) (*User, error)
+	Authenticate(ctx context.Context, email, password string) (*User, error)
+	GetUser(ctx context.Context, id int) (*User, error)
+}
+
+// Store keeps habits together with the users owning them, their sessions
+// and their API tokens
+type Store interface {
+	HabitStore
+	UserStore
+	SessionStore
+	TokenStore
+}
+
+// newUser checks the email and password of a new account and returns the
+// user with the normalized email and the bcrypt hash of the password
+func newUser(email, password string, now time.Time) (User, error) {
+	email = normalizeEmail(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return User{}, fmt.Errorf("%q is not a valid email address: %w", email, ErrInvalid)
+	}
+	if len(password) < minPasswordLength {
+		return User{}, fmt.Errorf("password must have at least %d characters: %w", minPasswordLength, ErrInvalid)
+	}
+	if len(password) > 72 {
+		return User{}, fmt.Errorf("password must have at most 72 bytes: %w", ErrInvalid)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to hash password with error: %w", err)
+	}
+	return User{Email: email, PasswordHash: string(hash), CreatedAt: now}, nil
+}
+
+// checkPassword returns ErrWrongPassword unless the password is the user's
+func (u User) checkPassword(password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
+	if err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// normalizeEmail makes emails differing only in case or surrounding spaces
+// the same
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// userKey is the context key of the user requests act on behalf of
+type userKey struct{}
+
+// WithUser returns a copy of ctx acting on behalf of the user: habit stores
+// given that context only see and change the habits the user owns
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the user ctx acts on behalf of, or nil when there is none
+func UserFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
+}
+
+// ownerID returns the ID of the user ctx acts on behalf of, or 0 for habits
+// without an owner, like the ones the command-line tool keeps
+func ownerID(ctx context.Context) int {
+	if user := UserFrom(ctx); user != nil {
+		return user.ID
+	}
+	return 0
+}
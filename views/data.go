@@ -1,5 +1,7 @@
 package views
 
+import "github.com/miloszizic/habits/store"
+
 const (
 	AlertLvlError   = "red"
 	AlertLvlSuccess = "green"
@@ -17,7 +19,12 @@ type Alert struct {
 }
 
 // Data is the top level structure that views expect data
-// to come in.
+// to come in. User is the signed-in user, if any, CSRFToken
+// goes into every form that posts and Yield holds whatever
+// else the page shows.
 type Data struct {
-	Alert *Alert
+	Alert     *Alert
+	User      *store.User
+	CSRFToken string
+	Yield     interface{}
 }
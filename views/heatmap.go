@@ -0,0 +1,114 @@
+package views
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+
+	"github.com/miloszizic/habits/store"
+)
+
+// Sizes of the heatmap in pixels: the squares of the days with the gap
+// between them, the room left for the weekday and month labels, and for the
+// legend below
+const (
+	heatmapCell        = 11
+	heatmapStep        = heatmapCell + 2
+	heatmapLeft        = 28
+	heatmapRight       = 8
+	heatmapTop         = 15
+	heatmapLegend      = 20
+	heatmapLegendWidth = 150
+)
+
+// heatmapColors are the shades of the squares, from nothing done to the
+// day performed in full, following the Tailwind gray and green palettes
+var heatmapColors = []string{"#e5e7eb", "#bbf7d0", "#4ade80", "#16a34a", "#166534"}
+
+const (
+	// heatmapPaused is the shade of paused days
+	heatmapPaused = "#bfdbfe"
+	// heatmapRelapse is the shade of the days a habit to quit was relapsed on
+	heatmapRelapse = "#f87171"
+)
+
+// Heatmap renders the activity of the habit, oldest first and starting on a
+// Monday, as an SVG grid like a GitHub contribution graph: a column for each
+// week and a square for each day, shaded by how much was done on it
+func Heatmap(h store.Habit, days []store.Activity) template.HTML {
+	weeks := (len(days) + 6) / 7
+	width := heatmapLeft + weeks*heatmapStep + heatmapRight
+	if width < heatmapLegendWidth {
+		width = heatmapLegendWidth
+	}
+	height := heatmapTop + 7*heatmapStep + heatmapLegend
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" class="text-gray-500" font-size="9" fill="currentColor" role="img" aria-label="Check-ins of the last year">`,
+		width, height, width, height)
+	for i, label := range []string{"Mon", "", "Wed", "", "Fri", "", ""} {
+		if label != "" {
+			fmt.Fprintf(&b, `<text x="0" y="%d">%s</text>`, heatmapTop+i*heatmapStep+heatmapCell-2, label)
+		}
+	}
+	for i, activity := range days {
+		week, weekday := i/7, i%7
+		x := heatmapLeft + week*heatmapStep
+		if activity.Date.Day() <= 7 && weekday == 0 {
+			fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, x, heatmapTop-5, activity.Date.Format("Jan"))
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" fill="%s"><title>%s</title></rect>`,
+			x, heatmapTop+weekday*heatmapStep, heatmapCell, heatmapCell, heatmapShade(h, activity),
+			template.HTMLEscapeString(heatmapTitle(h, activity)))
+	}
+	legend := heatmapTop + 7*heatmapStep + 6
+	fmt.Fprintf(&b, `<text x="%d" y="%d">Less</text>`, heatmapLeft, legend+heatmapCell-2)
+	for i, color := range heatmapColors {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" fill="%s"/>`,
+			heatmapLeft+24+i*heatmapStep, legend, heatmapCell, heatmapCell, color)
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d">More</text>`, heatmapLeft+28+len(heatmapColors)*heatmapStep, legend+heatmapCell-2)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// heatmapShade returns the color of the square of the day. Days performed
+// in full are the darkest, and days of quantitative habits short of the
+// target are shaded by how close they came.
+func heatmapShade(h store.Habit, activity store.Activity) string {
+	switch {
+	case h.Quitting() && activity.Performed:
+		return heatmapRelapse
+	case h.Quitting():
+		return heatmapColors[0]
+	case activity.Performed:
+		return heatmapColors[len(heatmapColors)-1]
+	case activity.Paused:
+		return heatmapPaused
+	case h.Quantitative() && activity.Amount > 0:
+		level := int(math.Ceil(activity.Amount / h.Target * float64(len(heatmapColors)-2)))
+		if level > len(heatmapColors)-2 {
+			level = len(heatmapColors) - 2
+		}
+		return heatmapColors[level]
+	}
+	return heatmapColors[0]
+}
+
+// heatmapTitle describes the day when hovering its square
+func heatmapTitle(h store.Habit, activity store.Activity) string {
+	date := activity.Date.Format("Mon, Jan 2, 2006")
+	switch {
+	case h.Quitting() && activity.Performed:
+		return date + ": relapsed"
+	case h.Quitting():
+		return date + ": no relapse"
+	case h.Quantitative() && activity.CheckIns > 0:
+		return fmt.Sprintf("%s: %g of %g %s", date, activity.Amount, h.Target, h.Unit)
+	case activity.CheckIns > 0:
+		return date + ": performed"
+	case activity.Paused:
+		return date + ": paused"
+	}
+	return date + ": not performed"
+}
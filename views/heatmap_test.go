@@ -0,0 +1,52 @@
+package views_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miloszizic/habits/store"
+	"github.com/miloszizic/habits/views"
+)
+
+func TestHeatmapDrawsASquarePerDay(t *testing.T) {
+	monday := time.Date(2021, 9, 27, 0, 0, 0, 0, time.UTC)
+	var days []store.Activity
+	for i := 0; i < 10; i++ {
+		days = append(days, store.Activity{Date: monday.AddDate(0, 0, i)})
+	}
+	days[0] = store.Activity{Date: monday, CheckIns: 1, Amount: 20, Performed: true}
+	days[1] = store.Activity{Date: monday.AddDate(0, 0, 1), CheckIns: 2, Amount: 5}
+	days[2].Paused = true
+	habit := store.Habit{Name: "read", Target: 20, Unit: "<pages>"}
+	svg := string(views.Heatmap(habit, days))
+	if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>") {
+		t.Fatalf("got %s; want an SVG", svg)
+	}
+	// The legend adds its own squares
+	if got := strings.Count(svg, "<title>"); got != len(days) {
+		t.Errorf("got %d squares with a title; want %d", got, len(days))
+	}
+	for _, want := range []string{
+		"Mon, Sep 27, 2021: 20 of 20 &lt;pages&gt;",
+		"Tue, Sep 28, 2021: 5 of 20 &lt;pages&gt;",
+		"Wed, Sep 29, 2021: paused",
+		"Thu, Sep 30, 2021: not performed",
+		">Oct</text>",
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("heatmap is missing %q: %s", want, svg)
+		}
+	}
+}
+
+func TestHeatmapMarksRelapses(t *testing.T) {
+	monday := time.Date(2021, 9, 27, 0, 0, 0, 0, time.UTC)
+	days := []store.Activity{{Date: monday}, {Date: monday.AddDate(0, 0, 1), CheckIns: 1, Amount: 1, Performed: true}}
+	svg := string(views.Heatmap(store.Habit{Name: "sugar", Kind: store.QuitHabit}, days))
+	for _, want := range []string{"Mon, Sep 27, 2021: no relapse", "Tue, Sep 28, 2021: relapsed"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("heatmap is missing %q: %s", want, svg)
+		}
+	}
+}